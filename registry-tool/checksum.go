@@ -0,0 +1,217 @@
+package main
+
+import (
+  "fmt"
+  "io/ioutil"
+  "sort"
+  "strings"
+  "gopkg.in/yaml.v3"
+  . "github.com/logrusorgru/aurora"
+  . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
+)
+
+/**
+ * A change to a single line of a version file
+ */
+type lineEdit struct {
+  // The (1-based) line to change
+  Line        int
+
+  // Insert the text as a new line, instead of replacing the line
+  Insert      bool
+  Text        string
+}
+
+/**
+ * The outcome of checking the checksums of a tools folder
+ */
+type ChecksumReport struct {
+  Filled      int
+  Verified    int
+  Problems    LintFindings
+}
+
+/**
+ * Return the value of the key in the mapping node, along with the node of
+ * the key, or nil if it's missing
+ */
+func mappingValue(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+  if node == nil || node.Kind != yaml.MappingNode {
+    return nil, nil
+  }
+  for i := 0; i + 1 < len(node.Content); i += 2 {
+    if node.Content[i].Value == key {
+      return node.Content[i], node.Content[i + 1]
+    }
+  }
+  return nil, nil
+}
+
+/**
+ * Download the source and calculate it's checksum, the same way the clients
+ * do when they install it
+ */
+func sourceChecksum(url string) (string, error) {
+  return Download(url, WithoutCompression).
+         AndShowProgress("").
+         EventuallyChecksum()
+}
+
+/**
+ * Check the checksums of the `file` and `archive/tar` sources in the version
+ * file, and return the edits that fill the missing ones
+ */
+func checksumVersionFile(file string, report *ChecksumReport) []lineEdit {
+  var edits []lineEdit
+  problem := func (line int, msg string) {
+    report.Problems = append(report.Problems, LintFinding{file, line, LintError, msg})
+  }
+
+  byt, err := ioutil.ReadFile(file)
+  if err != nil {
+    problem(0, fmt.Sprintf("cannot read file: %s", err.Error()))
+    return nil
+  }
+  root := new(yaml.Node)
+  if err := yaml.Unmarshal(byt, root); err != nil {
+    problem(0, fmt.Sprintf("cannot parse file: %s", err.Error()))
+    return nil
+  }
+  if len(root.Content) == 0 {
+    return nil
+  }
+
+  _, artifacts := mappingValue(root.Content[0], "artifacts")
+  if artifacts == nil || artifacts.Kind != yaml.SequenceNode {
+    return nil
+  }
+  for _, artifact := range artifacts.Content {
+    _, source := mappingValue(artifact, "source")
+    _, sourceType := mappingValue(source, "type")
+    if sourceType == nil || (sourceType.Value != "file" && sourceType.Value != "archive/tar") {
+      continue
+    }
+    urlKey, url := mappingValue(source, "url")
+    if url == nil || url.Value == "" {
+      problem(source.Line, "the source has no URL")
+      continue
+    }
+
+    fmt.Printf("%s %s %s\n", Blue("==> "), Gray("Downloading"), Bold(Gray(url.Value)))
+    checksum, err := sourceChecksum(url.Value)
+    if err != nil {
+      problem(url.Line, fmt.Sprintf("cannot download %s: %s", url.Value, err.Error()))
+      continue
+    }
+
+    // Never overwrite a checksum, since a mismatch means that the source
+    // has changed since it was recorded
+    checksumKey, recorded := mappingValue(source, "checksum")
+    if recorded != nil && recorded.Value != "" {
+      if recorded.Value != checksum {
+        problem(recorded.Line, fmt.Sprintf("checksum mismatch for %s: recorded %s, downloaded %s",
+          url.Value, recorded.Value, checksum))
+      } else {
+        report.Verified++
+      }
+      continue
+    }
+
+    // The values we can't safely edit line-by-line are left to the author
+    if source.Style & yaml.FlowStyle != 0 {
+      problem(source.Line, fmt.Sprintf("cannot fill the checksum of a flow-style source, it is %s", checksum))
+      continue
+    }
+
+    line := "checksum: " + yamlScalar(checksum)
+    if checksumKey != nil {
+      // Fill the empty `checksum:` line
+      indent := strings.Repeat(" ", checksumKey.Column - 1)
+      edits = append(edits, lineEdit{checksumKey.Line, false, indent + line})
+    } else if url.Line == urlKey.Line && url.Style & (yaml.LiteralStyle | yaml.FoldedStyle) == 0 {
+      // Add it right after the URL
+      indent := strings.Repeat(" ", urlKey.Column - 1)
+      edits = append(edits, lineEdit{urlKey.Line + 1, true, indent + line})
+    } else {
+      // Add it before a multi-line URL
+      indent := strings.Repeat(" ", urlKey.Column - 1)
+      edits = append(edits, lineEdit{urlKey.Line, true, indent + line})
+    }
+    report.Filled++
+  }
+
+  return edits
+}
+
+/**
+ * Apply the line edits on the file contents, keeping everything else as it is
+ */
+func applyLineEdits(contents string, edits []lineEdit) string {
+  lines := strings.Split(contents, "\n")
+
+  // Start from the bottom, so the line numbers of the rest don't change
+  sort.SliceStable(edits, func (i, j int) bool {
+    return edits[i].Line > edits[j].Line
+  })
+  for _, edit := range edits {
+    idx := edit.Line - 1
+    if idx > len(lines) {
+      idx = len(lines)
+    }
+    if edit.Insert {
+      lines = append(lines[:idx], append([]string{edit.Text}, lines[idx:]...)...)
+    } else if idx < len(lines) {
+      lines[idx] = edit.Text
+    }
+  }
+
+  return strings.Join(lines, "\n")
+}
+
+/**
+ * Download the sources of every tool version in the tools folder, fill the
+ * missing checksums in the version files, and report the ones that don't
+ * match
+ */
+func FillChecksums(folder string) (*ChecksumReport, error) {
+  report := new(ChecksumReport)
+
+  tools, err := ioutil.ReadDir(folder)
+  if err != nil {
+    return nil, err
+  }
+  for _, tool := range tools {
+    if !tool.IsDir() {
+      continue
+    }
+    toolFolder := folder + "/" + tool.Name()
+    files, err := ioutil.ReadDir(toolFolder)
+    if err != nil {
+      return nil, err
+    }
+
+    for _, f := range files {
+      fileName := f.Name()
+      if fileName == "package.yml" || !strings.HasSuffix(fileName, ".yml") {
+        continue
+      }
+
+      path := toolFolder + "/" + fileName
+      edits := checksumVersionFile(path, report)
+      if len(edits) == 0 {
+        continue
+      }
+
+      byt, err := ioutil.ReadFile(path)
+      if err != nil {
+        return nil, err
+      }
+      err = ioutil.WriteFile(path, []byte(applyLineEdits(string(byt), edits)), f.Mode())
+      if err != nil {
+        return nil, err
+      }
+    }
+  }
+
+  return report, nil
+}
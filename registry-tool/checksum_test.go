@@ -0,0 +1,159 @@
+package main
+
+import (
+  "crypto/sha256"
+  "encoding/hex"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "testing"
+)
+
+/**
+ * Serve a fixed tool binary and return it's checksum
+ */
+func toolServer() (*httptest.Server, string) {
+  contents := []byte("#!/bin/sh\necho tool\n")
+  sum := sha256.Sum256(contents)
+  server := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+    w.Write(contents)
+  }))
+  return server, hex.EncodeToString(sum[:])
+}
+
+func TestApplyLineEdits(t *testing.T) {
+  contents := "a: 1\nb: 2\nc: 3\n"
+  actual := applyLineEdits(contents, []lineEdit{
+    {2, false, "b: 4"},
+    {1, true, "# first"},
+    {4, true, "d: 5"},
+  })
+  expected := "# first\na: 1\nb: 4\nc: 3\nd: 5\n"
+  if actual != expected {
+    t.Errorf("expected:\n%s\ngot:\n%s", expected, actual)
+  }
+}
+
+func TestFillChecksums(t *testing.T) {
+  server, checksum := toolServer()
+  defer server.Close()
+
+  dir, err := ioutil.TempDir("", "checksum")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  if err := os.Mkdir(dir + "/tool", 0755); err != nil {
+    t.Fatal(err)
+  }
+
+  // The comments, the quoting and the odd indentation must all survive
+  url := server.URL + "/tool"
+  writeFixture(t, dir + "/tool", "package.yml", "desc: Tool\n")
+  path := writeFixture(t, dir + "/tool", "1.0.0.yml",
+    "# The linux binary\n" +
+    "artifacts:\n" +
+    "    - type: executable\n" +
+    "      platform: linux\n" +
+    "      arch: \"*\"\n" +
+    "      source:\n" +
+    "        type: file\n" +
+    "        url: '" + url + "'  # mirrored\n" +
+    "\n" +
+    "    # The darwin binary\n" +
+    "    - type: executable\n" +
+    "      platform: darwin\n" +
+    "      arch: \"*\"\n" +
+    "      source:\n" +
+    "        type: file\n" +
+    "        checksum: \"\"\n" +
+    "        url: " + url + "\n" +
+    "channel: beta\n")
+
+  report, err := FillChecksums(dir)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if report.Filled != 2 || report.Verified != 0 || len(report.Problems) != 0 {
+    t.Errorf("expected 2 filled checksums, got %+v", report)
+  }
+
+  byt, err := ioutil.ReadFile(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  expected := "# The linux binary\n" +
+    "artifacts:\n" +
+    "    - type: executable\n" +
+    "      platform: linux\n" +
+    "      arch: \"*\"\n" +
+    "      source:\n" +
+    "        type: file\n" +
+    "        url: '" + url + "'  # mirrored\n" +
+    "        checksum: " + checksum + "\n" +
+    "\n" +
+    "    # The darwin binary\n" +
+    "    - type: executable\n" +
+    "      platform: darwin\n" +
+    "      arch: \"*\"\n" +
+    "      source:\n" +
+    "        type: file\n" +
+    "        checksum: " + checksum + "\n" +
+    "        url: " + url + "\n" +
+    "channel: beta\n"
+  if string(byt) != expected {
+    t.Errorf("expected:\n%s\ngot:\n%s", expected, string(byt))
+  }
+
+  // A second pass only verifies them
+  report, err = FillChecksums(dir)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if report.Filled != 0 || report.Verified != 2 || len(report.Problems) != 0 {
+    t.Errorf("expected 2 verified checksums, got %+v", report)
+  }
+}
+
+func TestFillChecksumsMismatch(t *testing.T) {
+  server, _ := toolServer()
+  defer server.Close()
+
+  dir, err := ioutil.TempDir("", "checksum")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  if err := os.Mkdir(dir + "/tool", 0755); err != nil {
+    t.Fatal(err)
+  }
+
+  recorded := "0000000000000000000000000000000000000000000000000000000000000000"
+  contents := "artifacts:\n" +
+    "  - type: executable\n" +
+    "    platform: \"*\"\n" +
+    "    arch: \"*\"\n" +
+    "    source:\n" +
+    "      type: file\n" +
+    "      url: " + server.URL + "/tool\n" +
+    "      checksum: " + recorded + "\n"
+  path := writeFixture(t, dir + "/tool", "1.0.0.yml", contents)
+
+  report, err := FillChecksums(dir)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(report.Problems) != 1 || report.Problems[0].Line != 8 {
+    t.Errorf("expected a mismatch at line 8, got %v", report.Problems)
+  }
+
+  // The recorded checksum is never overwritten
+  byt, err := ioutil.ReadFile(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if string(byt) != contents {
+    t.Errorf("expected the file to be unchanged, got:\n%s", string(byt))
+  }
+}
@@ -4,15 +4,29 @@ import (
   "fmt"
   "io/ioutil"
   "crypto"
+  "crypto/ecdsa"
+  "crypto/ed25519"
+  "crypto/elliptic"
   "crypto/rand"
   "crypto/rsa"
+  "crypto/sha256"
   "crypto/x509"
+  "encoding/hex"
+  "encoding/json"
   "encoding/pem"
+  "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  "path/filepath"
+  "strings"
+  "time"
   . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
 )
 
-
-func LoadPrivateKey(file string) (*rsa.PrivateKey, error) {
+/**
+ * Load a PEM-encoded private key, either a PKCS#1 RSA key, a SEC 1 ECDSA key
+ * or a PKCS#8 RSA, ECDSA P-256 or Ed25519 key. The keys can be encrypted as
+ * PKCS#8, or with the legacy PEM encryption of the older keys.
+ */
+func LoadPrivateKey(file string) (crypto.Signer, error) {
   var keyBytes []byte
 
   // Load file
@@ -28,14 +42,19 @@ func LoadPrivateKey(file string) (*rsa.PrivateKey, error) {
   }
 
   // Read password
-  if x509.IsEncryptedPEMBlock(block) {
+  if block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block) {
     passwd, err := PasswordPrompt("Key Password: ")
     if err != nil {
       return nil, fmt.Errorf("unable to read private key password: %s", err.Error())
     }
 
-    // Decrypt PEM block
-    keyBytes, err = x509.DecryptPEMBlock(block, passwd)
+    // Decrypt PEM block. The legacy PEM encryption is only read, for the
+    // keys created before the PKCS#8 ones.
+    if block.Type == "ENCRYPTED PRIVATE KEY" {
+      keyBytes, err = DecryptPKCS8PrivateKey(block.Bytes, passwd)
+    } else {
+      keyBytes, err = x509.DecryptPEMBlock(block, passwd)
+    }
     if err != nil {
       return nil, fmt.Errorf("unable to decrypt private key: %s", err.Error())
     }
@@ -44,29 +63,210 @@ func LoadPrivateKey(file string) (*rsa.PrivateKey, error) {
   }
 
   // Parse private key
-  key, err := x509.ParsePKCS1PrivateKey(keyBytes)
+  key, err := parsePrivateKey(block.Type, keyBytes)
   if err != nil {
-    panic("failed to parse DER encoded private key: " + err.Error())
+    return nil, fmt.Errorf("failed to parse DER encoded private key: %s", err.Error())
+  }
+  if KeyAlgorithm(key.Public()) == "" {
+    return nil, fmt.Errorf("private key is not an RSA, ECDSA P-256 or Ed25519 key")
   }
 
   // Key is ready
   return key, nil
 }
 
-func SignPayload(byt []byte, key *rsa.PrivateKey) ([]byte, error) {
-  var opts rsa.PSSOptions
-  opts.SaltLength = rsa.PSSSaltLengthAuto
+/**
+ * Parse the DER encoded private key, according to the type of it's PEM block
+ */
+func parsePrivateKey(blockType string, der []byte) (crypto.Signer, error) {
+  switch blockType {
+    case "RSA PRIVATE KEY":
+      return x509.ParsePKCS1PrivateKey(der)
+    case "EC PRIVATE KEY":
+      return x509.ParseECPrivateKey(der)
+  }
 
+  key, err := x509.ParsePKCS8PrivateKey(der)
+  if err != nil {
+    return nil, err
+  }
+  signer, ok := key.(crypto.Signer)
+  if !ok {
+    return nil, fmt.Errorf("unsupported private key type")
+  }
+  return signer, nil
+}
+
+/**
+ * Create a raw signature of the payload, with the algorithm of the key
+ */
+func SignPayload(byt []byte, key crypto.Signer) ([]byte, error) {
   hashAlgo := crypto.SHA256
 
-  pssh := hashAlgo.New()
-  pssh.Write(byt)
-  hashed := pssh.Sum(nil)
+  h := hashAlgo.New()
+  h.Write(byt)
+  hashed := h.Sum(nil)
+
+  switch key := key.(type) {
+    case *rsa.PrivateKey:
+      var opts rsa.PSSOptions
+      opts.SaltLength = rsa.PSSSaltLengthAuto
+      return rsa.SignPSS(rand.Reader, key, hashAlgo, hashed, &opts)
+
+    case *ecdsa.PrivateKey:
+      return ecdsa.SignASN1(rand.Reader, key, hashed)
+
+    case ed25519.PrivateKey:
+      // The digest is signed as the message, so the clients can verify it
+      // while streaming, like the other algorithms
+      return ed25519.Sign(key, hashed), nil
+  }
+
+  return nil, fmt.Errorf("unsupported private key type")
+}
 
-  signature, err := rsa.SignPSS(rand.Reader, key, hashAlgo, hashed, &opts)
+/**
+ * Create a detached signature of the payload, that carries the ID of the
+ * key and the algorithm, so the clients know which of their trusted keys to
+ * verify it with
+ */
+func SignDetached(byt []byte, key crypto.Signer) ([]byte, error) {
+  signature, err := SignPayload(byt, key)
   if err != nil {
     return nil, err
   }
 
-  return signature, nil
+  return Signature{
+    KeyID: KeyID(key.Public()),
+    Algorithm: KeyAlgorithm(key.Public()),
+    Signature: signature,
+  }.Bytes()
+}
+
+/**
+ * Endorse the new public key with the private key, and append the
+ * endorsement to the key rotation document
+ */
+func EndorseKey(rotationsPath string, newKeyPath string, key crypto.Signer, retireAfter string) error {
+  newKeyPEM, err := ioutil.ReadFile(newKeyPath)
+  if err != nil {
+    return fmt.Errorf("unable to load public key: %s", err.Error())
+  }
+  newKey, err := ParsePublicKeyPEM(newKeyPEM)
+  if err != nil {
+    return err
+  }
+  if retireAfter != "" {
+    if _, err := time.Parse(time.RFC3339, retireAfter); err != nil {
+      return fmt.Errorf("invalid retirement date: %s", err.Error())
+    }
+  }
+
+  // Load the existing rotations
+  doc := new(registry.KeyRotations)
+  if byt, err := ioutil.ReadFile(rotationsPath); err == nil {
+    doc, err = registry.ParseKeyRotations(byt)
+    if err != nil {
+      return err
+    }
+  }
+
+  // Sign the endorsement
+  rotation := registry.KeyRotation{
+    Key: strings.TrimSpace(string(newKeyPEM)),
+    EndorsedBy: KeyID(key.Public()),
+    RetireAfter: retireAfter,
+  }
+  payload, err := rotation.Payload()
+  if err != nil {
+    return err
+  }
+  rotation.Signature, err = SignDetached(payload, key)
+  if err != nil {
+    return err
+  }
+  doc.Rotations = append(doc.Rotations, rotation)
+
+  byt, err := json.MarshalIndent(doc, "", "  ")
+  if err != nil {
+    return err
+  }
+  fmt.Printf("Key %s endorses key %s\n", rotation.EndorsedBy, KeyID(newKey))
+  return ioutil.WriteFile(rotationsPath, byt, 0644)
+}
+
+/**
+ * Write the signed manifest of a release, that lists the checksums of the
+ * given release files, next to the first one
+ */
+func SignRelease(version SemVer, files []string, key crypto.Signer) (string, error) {
+  manifest := ReleaseManifest{Version: version, Assets: make(map[string]string)}
+  for _, file := range files {
+    byt, err := ioutil.ReadFile(file)
+    if err != nil {
+      return "", err
+    }
+    sum := sha256.Sum256(byt)
+    manifest.Assets[filepath.Base(file)] = hex.EncodeToString(sum[:])
+  }
+
+  byt, err := json.MarshalIndent(manifest, "", "  ")
+  if err != nil {
+    return "", err
+  }
+  signature, err := SignDetached(byt, key)
+  if err != nil {
+    return "", err
+  }
+
+  manifestPath := filepath.Join(filepath.Dir(files[0]), ReleaseManifestName)
+  if err := ioutil.WriteFile(manifestPath, byt, 0644); err != nil {
+    return "", err
+  }
+  return manifestPath, ioutil.WriteFile(manifestPath + ".sig", signature, 0644)
+}
+
+/**
+ * Generate a new private key for the given algorithm
+ */
+func GenerateKey(algorithm string) (crypto.Signer, error) {
+  switch algorithm {
+    case "rsa":
+      return rsa.GenerateKey(rand.Reader, 4096)
+    case "ecdsa":
+      return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    case "ed25519":
+      _, key, err := ed25519.GenerateKey(rand.Reader)
+      return key, err
+  }
+  return nil, fmt.Errorf("unknown key algorithm '%s', expecting rsa, ecdsa or ed25519", algorithm)
+}
+
+/**
+ * Encode the private key as a password-encrypted PKCS#8 PEM block, that
+ * `LoadPrivateKey` and openssl understand
+ */
+func EncryptedPrivateKeyPEM(key crypto.Signer, passwd []byte) ([]byte, error) {
+  der, err := x509.MarshalPKCS8PrivateKey(key)
+  if err != nil {
+    return nil, err
+  }
+
+  encrypted, err := EncryptPKCS8PrivateKey(der, passwd)
+  if err != nil {
+    return nil, fmt.Errorf("unable to encrypt private key: %s", err.Error())
+  }
+  return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted}), nil
+}
+
+/**
+ * Encode the public key of the private key as PEM, ready to be used as the
+ * `pubKey` of a registry
+ */
+func PublicKeyPEM(key crypto.Signer) ([]byte, error) {
+  der, err := x509.MarshalPKIXPublicKey(key.Public())
+  if err != nil {
+    return nil, err
+  }
+  return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
 }
@@ -0,0 +1,442 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+  "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  ghodss "github.com/ghodss/yaml"
+  "gopkg.in/yaml.v3"
+  . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
+)
+
+/**
+ * How bad a lint finding is. Errors make the lint fail, warnings don't.
+ */
+const (
+  LintError     = "error"
+  LintWarning   = "warning"
+)
+
+/**
+ * A problem found in a tool definition file
+ */
+type LintFinding struct {
+  File        string    `json:"file"`
+  Line        int       `json:"line"`
+  Severity    string    `json:"severity"`
+  Message     string    `json:"message"`
+}
+
+/**
+ * All the findings of a lint run
+ */
+type LintFindings []LintFinding
+
+/**
+ * The platforms and architectures we know the tools are built for
+ */
+var knownPlatforms = []string{"*", "linux", "darwin", "windows", "freebsd"}
+var knownArchs = []string{"*", "amd64", "386", "arm", "arm64"}
+
+/**
+ * The keys an interpreter definition can have
+ */
+var interpreterKeys = []string{"python", "installRequirements", "installPip",
+  "shell", "java", "javaArgs", "environment"}
+
+/**
+ * The findings of a single YAML file, that know how to locate the line of
+ * a value in the file
+ */
+type fileLinter struct {
+  file        string
+  root        *yaml.Node
+  findings    LintFindings
+}
+
+/**
+ * Check if the value is one of the given ones
+ */
+func oneOf(value string, values []string) bool {
+  for _, v := range values {
+    if v == value {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Find the value at the given path, that consists of mapping keys and
+ * sequence indices. Returns nil if the value is missing, along with the line
+ * of the value, or of it's closest parent if it's missing.
+ */
+func (l *fileLinter) find(path ...interface{}) (*yaml.Node, int) {
+  if l.root == nil || len(l.root.Content) == 0 {
+    return nil, 0
+  }
+
+  node := l.root.Content[0]
+  line := node.Line
+  for _, part := range path {
+    var next *yaml.Node = nil
+    switch key := part.(type) {
+      case string:
+        if node.Kind == yaml.MappingNode {
+          for i := 0; i + 1 < len(node.Content); i += 2 {
+            if node.Content[i].Value == key {
+              line = node.Content[i].Line
+              next = node.Content[i + 1]
+              break
+            }
+          }
+        }
+      case int:
+        if node.Kind == yaml.SequenceNode && key < len(node.Content) {
+          next = node.Content[key]
+          line = next.Line
+        }
+    }
+    if next == nil {
+      return nil, line
+    }
+    node = next
+  }
+
+  return node, line
+}
+
+/**
+ * Report a problem with the value at the given path
+ */
+func (l *fileLinter) report(severity string, msg string, path ...interface{}) {
+  _, line := l.find(path...)
+  l.findings = append(l.findings, LintFinding{l.file, line, severity, msg})
+}
+
+/**
+ * The checksums of the sources are lower-case SHA256 hex digests, since
+ * that's what the clients compare them with
+ */
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+/**
+ * Line numbers of the YAML parse errors
+ */
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+/**
+ * Read and parse the YAML file into `dat`, reporting any problems. Returns
+ * false if the file could not be parsed at all.
+ */
+func (l *fileLinter) load(dat interface{}) bool {
+  byt, err := ioutil.ReadFile(l.file)
+  if err != nil {
+    l.report(LintError, fmt.Sprintf("cannot read file: %s", err.Error()))
+    return false
+  }
+
+  // The node tree is only used for locating the lines
+  l.root = new(yaml.Node)
+  if err := yaml.Unmarshal(byt, l.root); err != nil {
+    l.root = nil
+    line := 0
+    if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+      line, _ = strconv.Atoi(match[1])
+    }
+    l.findings = append(l.findings, LintFinding{l.file, line, LintError,
+      fmt.Sprintf("cannot parse file: %s", err.Error())})
+    return false
+  }
+
+  // Parse it the same way `update` does
+  if err := ghodss.Unmarshal(byt, dat); err != nil {
+    l.report(LintError, fmt.Sprintf("invalid definition: %s", err.Error()))
+    return false
+  }
+  return true
+}
+
+/**
+ * Lint the `package.yml` of a tool
+ */
+func lintToolInfo(file string) LintFindings {
+  l := &fileLinter{file: file}
+  var info registry.ToolInfo
+  if !l.load(&info) {
+    return l.findings
+  }
+
+  if strings.TrimSpace(info.Desc) == "" {
+    l.report(LintError, "the tool has no description", "desc")
+  }
+  if info.Help.ToolHelpText == nil && info.Help.ToolHelpURL == nil {
+    l.report(LintWarning, "the tool has no help text or URL", "help")
+  } else if info.Help.ToolHelpURL != nil && info.Help.URL == "" {
+    l.report(LintError, "the help URL is empty", "help", "url")
+  }
+  if len(info.Topics) == 0 {
+    l.report(LintWarning, "the tool has no topics", "topics")
+  }
+
+  return l.findings
+}
+
+/**
+ * Lint an executable artifact
+ */
+func (l *fileLinter) lintExecutable(artifact *registry.ExecutableToolArtifact, idx int) {
+  at := func (path ...interface{}) []interface{} {
+    return append([]interface{}{"artifacts", idx}, path...)
+  }
+
+  // Check the source
+  source := artifact.Source
+  checksum := ""
+  if source.WebFileSource != nil {
+    if source.FileURL == "" {
+      l.report(LintError, "the source has no URL", at("source")...)
+    }
+    checksum = source.FileChecksum
+  } else if source.WebArchiveTarSource != nil {
+    if source.TarURL == "" {
+      l.report(LintError, "the source has no URL", at("source")...)
+    }
+    checksum = source.TarChecksum
+  } else if source.VCSGitSource != nil {
+    if source.GitURL == "" {
+      l.report(LintError, "the source has no URL", at("source")...)
+    }
+    if source.GitBranch == "" {
+      l.report(LintWarning, "the git source is not pinned to a branch or tag", at("source")...)
+    }
+  } else {
+    l.report(LintError, "the artifact has no source", at()...)
+  }
+  if source.VCSGitSource == nil && (source.WebFileSource != nil || source.WebArchiveTarSource != nil) {
+    if checksum == "" {
+      l.report(LintError, "the source has no checksum", at("source")...)
+    } else if !sha256Hex.MatchString(checksum) {
+      l.report(LintError, "the source checksum is not a lower-case SHA256 hex digest", at("source", "checksum")...)
+    }
+  }
+
+  // Check the interpreter, or the system the binary runs on
+  if artifact.Interpreter != nil {
+    node, _ := l.find(at("interpreter")...)
+    if node != nil && node.Kind == yaml.MappingNode {
+      for i := 0; i + 1 < len(node.Content); i += 2 {
+        if key := node.Content[i].Value; !oneOf(key, interpreterKeys) {
+          l.report(LintError, fmt.Sprintf("unknown interpreter `%s`", key), at("interpreter", key)...)
+        }
+      }
+    }
+
+    count := 0
+    if artifact.Interpreter.PythonInterpreter != nil {
+      count++
+    }
+    if artifact.Interpreter.ShellInterpreter != nil {
+      count++
+    }
+    if artifact.Interpreter.JavaInterpreter != nil {
+      count++
+    }
+    if count == 0 {
+      l.report(LintError, "the interpreter is not python, shell or java", at("interpreter")...)
+    } else if count > 1 {
+      l.report(LintError, "the artifact has more than one interpreter", at("interpreter")...)
+    }
+  } else {
+    if artifact.Platform == "" {
+      l.report(LintError, "the binary has no platform (use `*` for any)", at()...)
+    } else if !oneOf(artifact.Platform, knownPlatforms) {
+      l.report(LintWarning, fmt.Sprintf("unknown platform '%s'", artifact.Platform), at("platform")...)
+    }
+    if artifact.Arch == "" {
+      l.report(LintError, "the binary has no architecture (use `*` for any)", at()...)
+    } else if !oneOf(artifact.Arch, knownArchs) {
+      l.report(LintWarning, fmt.Sprintf("unknown architecture '%s'", artifact.Arch), at("arch")...)
+    }
+  }
+
+  // Check the requirements
+  for reqIdx, req := range artifact.Require {
+    if req.CommandRequirement == nil && req.ExecRequirement == nil && req.ToolRequirement == nil {
+      l.report(LintError, "the requirement is not a command, exec or tool", at("require", reqIdx)...)
+    }
+    if req.ToolRequirement != nil && req.ToolRequirement.Version != "" {
+      if _, err := ParseVersionConstraint(req.ToolRequirement.Version); err != nil {
+        l.report(LintError, fmt.Sprintf("invalid version constraint: %s", err.Error()),
+          at("require", reqIdx, "version")...)
+      }
+    }
+  }
+}
+
+/**
+ * Lint a docker artifact
+ */
+func (l *fileLinter) lintDocker(artifact *registry.DockerToolArtifact, idx int) {
+  if artifact.Image == "" {
+    l.report(LintError, "the docker artifact has no image", "artifacts", idx)
+  }
+  if artifact.Tag == "" {
+    l.report(LintError, "the docker artifact has no tag", "artifacts", idx)
+  } else if artifact.Tag == "latest" {
+    l.report(LintWarning, "the docker artifact uses the `latest` tag", "artifacts", idx, "tag")
+  }
+}
+
+/**
+ * Lint the YAML file of a tool version
+ */
+func lintToolVersion(file string) LintFindings {
+  l := &fileLinter{file: file}
+  var version registry.ToolVersion
+  if !l.load(&version) {
+    return l.findings
+  }
+
+  if version.Channel != "" {
+    if err := registry.CheckChannel(version.Channel); err != nil {
+      l.report(LintError, err.Error(), "channel")
+    }
+  }
+  if version.Yanked && version.YankedReason == "" {
+    l.report(LintWarning, "the version is yanked without a reason", "yanked")
+  }
+
+  if len(version.Artifacts) == 0 {
+    l.report(LintError, "the version has no artifacts", "artifacts")
+  }
+  for idx, artifact := range version.Artifacts {
+    switch artifact.Type {
+      case registry.Docker:
+        if artifact.DockerToolArtifact == nil {
+          l.report(LintError, "the docker artifact has no image", "artifacts", idx)
+          continue
+        }
+        l.lintDocker(artifact.DockerToolArtifact, idx)
+      case registry.Executable:
+        if artifact.ExecutableToolArtifact == nil {
+          l.report(LintError, "the executable artifact has no source", "artifacts", idx)
+          continue
+        }
+        l.lintExecutable(artifact.ExecutableToolArtifact, idx)
+    }
+  }
+
+  return l.findings
+}
+
+/**
+ * Lint the definition files in the tool folder
+ */
+func LintToolFolder(folder string) LintFindings {
+  var findings LintFindings
+
+  files, err := ioutil.ReadDir(folder)
+  if err != nil {
+    return LintFindings{{folder, 0, LintError, err.Error()}}
+  }
+
+  hasPackage := false
+  for _, f := range files {
+    fileName := f.Name()
+    path := folder + "/" + fileName
+    if fileName == "package.yml" {
+      hasPackage = true
+      findings = append(findings, lintToolInfo(path)...)
+      continue
+    }
+    if !strings.HasSuffix(fileName, ".yml") {
+      findings = append(findings, LintFinding{path, 0, LintError, "unexpected file"})
+      continue
+    }
+    if _, err := ParseSemVer(fileName[:len(fileName) - 4]); err != nil {
+      findings = append(findings, LintFinding{path, 0, LintError,
+        fmt.Sprintf("the file name is not a version: %s", err.Error())})
+      continue
+    }
+    findings = append(findings, lintToolVersion(path)...)
+  }
+  if !hasPackage {
+    findings = append(findings, LintFinding{folder, 0, LintError, "could not find 'package.yml'"})
+  }
+
+  return findings
+}
+
+/**
+ * Lint every tool in the tools folder
+ */
+func LintRegistryFolder(folder string) (LintFindings, error) {
+  var findings LintFindings
+
+  files, err := ioutil.ReadDir(folder)
+  if err != nil {
+    return nil, err
+  }
+  for _, f := range files {
+    if !f.IsDir() {
+      findings = append(findings, LintFinding{folder + "/" + f.Name(), 0, LintError, "unexpected file"})
+      continue
+    }
+    findings = append(findings, LintToolFolder(folder + "/" + f.Name())...)
+  }
+
+  sort.SliceStable(findings, func (i, j int) bool {
+    if findings[i].File != findings[j].File {
+      return findings[i].File < findings[j].File
+    }
+    return findings[i].Line < findings[j].Line
+  })
+  return findings, nil
+}
+
+/**
+ * Check if there is any error in the findings
+ */
+func (f LintFindings) HasErrors() bool {
+  for _, finding := range f {
+    if finding.Severity == LintError {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Format the findings for humans, as `file:line: severity: message`
+ */
+func (f LintFindings) Text() string {
+  var lines []string
+  for _, finding := range f {
+    location := finding.File
+    if finding.Line > 0 {
+      location = fmt.Sprintf("%s:%d", finding.File, finding.Line)
+    }
+    lines = append(lines, fmt.Sprintf("%s: %s: %s", location, finding.Severity, finding.Message))
+  }
+  return strings.Join(lines, "\n")
+}
+
+/**
+ * Format the findings as JSON, for CI
+ */
+func (f LintFindings) JSON() (string, error) {
+  if f == nil {
+    f = LintFindings{}
+  }
+  byt, err := json.MarshalIndent(f, "", "  ")
+  if err != nil {
+    return "", err
+  }
+  return string(byt), nil
+}
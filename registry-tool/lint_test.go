@@ -0,0 +1,145 @@
+package main
+
+import (
+  "io/ioutil"
+  "os"
+  "testing"
+)
+
+/**
+ * Write the fixture in a temporary folder and return it's path
+ */
+func writeFixture(t *testing.T, dir string, name string, contents string) string {
+  path := dir + "/" + name
+  if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+    t.Fatal(err)
+  }
+  return path
+}
+
+/**
+ * Check that the findings have the given message at the given line
+ */
+func expectFinding(t *testing.T, name string, findings LintFindings, message string, line int) {
+  for _, finding := range findings {
+    if finding.Message == message {
+      if finding.Line != line {
+        t.Errorf("%s: expected '%s' at line %d, got line %d", name, message, line, finding.Line)
+      }
+      return
+    }
+  }
+  t.Errorf("%s: expected '%s' at line %d, got %v", name, message, line, findings)
+}
+
+func TestLintToolVersion(t *testing.T) {
+  dir, err := ioutil.TempDir("", "lint")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  tests := []struct {
+    name        string
+    contents    string
+    message     string
+    line        int
+  }{
+    {
+      "missing docker tag",
+      "# Docker image\nartifacts:\n  - type: docker\n    image: tool\n",
+      "the docker artifact has no tag", 3,
+    },
+    {
+      "latest docker tag",
+      "artifacts:\n  - type: docker\n    image: tool\n    tag: latest\n",
+      "the docker artifact uses the `latest` tag", 4,
+    },
+    {
+      "bad checksum",
+      "artifacts:\n  - type: executable\n    platform: \"*\"\n    arch: \"*\"\n    source:\n" +
+        "      type: file\n      url: https://example.com/tool\n      checksum: ABC\n",
+      "the source checksum is not a lower-case SHA256 hex digest", 8,
+    },
+    {
+      "missing checksum",
+      "artifacts:\n  - type: executable\n    platform: \"*\"\n    arch: \"*\"\n    source:\n" +
+        "      type: file\n      url: https://example.com/tool\n",
+      "the source has no checksum", 5,
+    },
+    {
+      "unknown platform",
+      "artifacts:\n  - type: executable\n    platform: plan9\n    arch: \"*\"\n    source:\n" +
+        "      type: vcs/git\n      url: https://example.com/tool.git\n      branch: v1\n",
+      "unknown platform 'plan9'", 3,
+    },
+    {
+      "missing architecture",
+      "artifacts:\n\n  - type: executable\n    platform: linux\n    source:\n" +
+        "      type: vcs/git\n      url: https://example.com/tool.git\n      branch: v1\n",
+      "the binary has no architecture (use `*` for any)", 3,
+    },
+    {
+      "invalid requirement version",
+      "artifacts:\n  - type: executable\n    platform: \"*\"\n    arch: \"*\"\n    source:\n" +
+        "      type: vcs/git\n      url: https://example.com/tool.git\n      branch: v1\n" +
+        "    require:\n      - tool: kubectl\n        version: ^01.2\n",
+      "invalid version constraint: invalid version constraint '^01.2': invalid version '01.2' (numbers can't have leading zeros)", 11,
+    },
+    {
+      "no artifacts",
+      "channel: beta\n",
+      "the version has no artifacts", 1,
+    },
+    {
+      "unknown channel",
+      "artifacts: []\nchannel: nightly\n",
+      "unknown channel 'nightly' (expecting one of [stable beta alpha])", 2,
+    },
+  }
+
+  for _, test := range tests {
+    path := writeFixture(t, dir, "1.0.0.yml", test.contents)
+    expectFinding(t, test.name, lintToolVersion(path), test.message, test.line)
+  }
+}
+
+func TestLintToolVersionParseError(t *testing.T) {
+  dir, err := ioutil.TempDir("", "lint")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  // The string that is never closed starts at line 2
+  path := writeFixture(t, dir, "1.0.0.yml", "channel: beta\nartifacts: \"x\ndesc: tool\n")
+  findings := lintToolVersion(path)
+  if len(findings) != 1 || findings[0].Severity != LintError || findings[0].Line != 2 {
+    t.Errorf("expected a parse error at line 2, got %v", findings)
+  }
+}
+
+func TestLintToolInfo(t *testing.T) {
+  dir, err := ioutil.TempDir("", "lint")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  tests := []struct {
+    name        string
+    contents    string
+    message     string
+    line        int
+  }{
+    {"missing description", "help:\n  text: Tool\ntopics: [a]\n", "the tool has no description", 1},
+    {"empty description", "topics: [a]\ndesc: \"\"\nhelp:\n  text: Tool\n", "the tool has no description", 2},
+    {"empty help URL", "desc: Tool\ntopics: [a]\nhelp:\n  url: \"\"\n", "the help URL is empty", 4},
+    {"no topics", "desc: Tool\nhelp:\n  text: Tool\n", "the tool has no topics", 1},
+  }
+
+  for _, test := range tests {
+    path := writeFixture(t, dir, "package.yml", test.contents)
+    expectFinding(t, test.name, lintToolInfo(path), test.message, test.line)
+  }
+}
@@ -4,9 +4,11 @@ import (
   "flag"
   "fmt"
   "io/ioutil"
+  "crypto"
   "crypto/rsa"
   "github.com/mesosphere/dcos-sonic-screwdriver/registry"
   "os"
+  "strings"
   . "github.com/logrusorgru/aurora"
   . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
 )
@@ -14,8 +16,8 @@ import (
 /**
  * The current (hard-coded) version
  */
-func GetVersion() VersionTriplet {
-  return VersionTriplet{0,1,0}
+func GetVersion() SemVer {
+  return NewSemVer(0,1,0)
 }
 
 /**
@@ -38,6 +40,15 @@ func help() {
   fmt.Println("Typical usage:")
   fmt.Println("  registry-tool -f [regsitry.json] -k [private.pem] sign")
   fmt.Println("  registry-tool -f [regsitry.json] -k [private.pem] -d [tools/dir] update")
+  fmt.Println("  registry-tool -k [private.pem] sign-file [FILE]")
+  fmt.Println("  registry-tool -k [private.pem] sign-release [VERSION] [FILE...]")
+  fmt.Println("  registry-tool -f [regsitry.json] -k [old-private.pem] endorse [new-public.pem] [RETIRE-AFTER]")
+  fmt.Println("  registry-tool -k [private.pem] keygen [public.pem] [rsa|ecdsa|ed25519]")
+  fmt.Println("  registry-tool -f [regsitry.json] verify [public.pem]")
+  fmt.Println("  registry-tool -d [tools/dir] [-format json] lint")
+  fmt.Println("  registry-tool -d [tools/dir] checksum")
+  fmt.Println("  registry-tool -d [tools/dir] [-topics a,b] new tool [NAME] [DESCRIPTION]")
+  fmt.Println("  registry-tool -d [tools/dir] [-artifact docker|file|tar|git] [-interpreter python|shell|java] [-source URL] new version [NAME] [VERSION]")
   fmt.Println("")
   os.Exit(2)
 }
@@ -77,9 +88,9 @@ func getRegistryPath(fRegistry string) string {
 }
 
 /**
- * Get private key either from environment or from the arguments and load it
+ * Get the private key path ether from environment or from the argument
  */
-func loadPrivateKey(fKey string) *rsa.PrivateKey {
+func getPrivateKeyPath(fKey string) string {
   var keyPath string = "private.pem"
 
   envKey := os.Getenv("SS_REGISTRY_PRIVATE_KEY")
@@ -91,7 +102,14 @@ func loadPrivateKey(fKey string) *rsa.PrivateKey {
     keyPath = fKey
   }
 
-  key, err := LoadPrivateKey(keyPath)
+  return keyPath
+}
+
+/**
+ * Get private key either from environment or from the arguments and load it
+ */
+func loadPrivateKey(fKey string) crypto.Signer {
+  key, err := LoadPrivateKey(getPrivateKeyPath(fKey))
   if err != nil {
     die(err.Error())
   }
@@ -112,14 +130,31 @@ func saveAndSign(reg *registry.Registry, registryPath string, fKey string) {
     die(err.Error())
   }
 
-  // Calculate signature
-  signature, err := SignPayload(registryContents, key)
+  // Make sure the clients are going to accept it
+  if err := registry.ValidateRegistry(registryContents); err != nil {
+    die(err.Error())
+  }
+
+  // Calculate the signature envelope, that the newer clients prefer, and the
+  // raw signature in `.sig` that the older ones verify. These only know RSA,
+  // so for the other algorithms `.sig` gets the envelope too.
+  envelope, err := SignDetached(registryContents, key)
   if err != nil {
     die(err.Error())
   }
+  signature := envelope
+  if _, ok := key.(*rsa.PrivateKey); ok {
+    signature, err = SignPayload(registryContents, key)
+    if err != nil {
+      die(err.Error())
+    }
+  }
 
-  // Save signature
+  // Save signatures
   err = ioutil.WriteFile(registryPath + ".sig", signature, 0644)
+  if err == nil {
+    err = ioutil.WriteFile(registryPath + ".sig2", envelope, 0644)
+  }
   if err != nil {
     die(err.Error())
   }
@@ -152,6 +187,11 @@ func main() {
   fRegistry := flag.String("f", "registry.json", "Path to the registry file")
   fRegistryFolder := flag.String("d", "registry", "Path to the tools directory")
   fKey := flag.String("k", "private.pem", "Path to the private key file")
+  fFormat := flag.String("format", "text", "The output format of lint (text or json)")
+  fTopics := flag.String("topics", "", "The comma-separated topics of a new tool")
+  fArtifact := flag.String("artifact", "", "The artifact type of a new version (docker, file, tar or git)")
+  fInterpreter := flag.String("interpreter", "", "The interpreter of a new version (python, shell or java)")
+  fSource := flag.String("source", "", "The source URL or docker image of a new version")
   flag.Parse()
   if flag.NArg() < 1 {
     help()
@@ -173,8 +213,8 @@ func main() {
       }
 
       // Configure settings
-      reg.Version = 1
-      reg.ToolVersion = VersionTriplet{0,1,4}
+      reg.Version = registry.SchemaVersion
+      reg.ToolVersion = NewSemVer(0,1,4)
 
       // Save and sign
       registryPath := getRegistryPath(*fRegistry)
@@ -196,7 +236,271 @@ func main() {
 
       // Save and sign
       saveAndSign(reg, registryPath, *fKey)
-      complete("Signature saved on " + registryPath + ".sig")
+      complete("Signatures saved on " + registryPath + ".sig and " + registryPath + ".sig2")
+
+    //
+    // Create a detached signature for an arbitrary file (eg. a release binary)
+    //
+    case "sign-file":
+      if flag.NArg() < 2 {
+        fmt.Println("Missing file to sign")
+        help()
+      }
+
+      // Load file contents
+      fileName := flag.Arg(1)
+      contents, err := ioutil.ReadFile(fileName)
+      if err != nil {
+        die(err.Error())
+      }
+
+      // Calculate and save signature. Release binaries signed with RSA keep
+      // the raw signature, since that's what older clients verify before
+      // upgrading, and they can't verify the other algorithms anyway.
+      key := loadPrivateKey(*fKey)
+      var signature []byte
+      if _, ok := key.(*rsa.PrivateKey); ok {
+        signature, err = SignPayload(contents, key)
+      } else {
+        signature, err = SignDetached(contents, key)
+      }
+      if err != nil {
+        die(err.Error())
+      }
+      err = ioutil.WriteFile(fileName + ".sig", signature, 0644)
+      if err != nil {
+        die(err.Error())
+      }
+      complete("Signature saved on " + fileName + ".sig")
+
+    //
+    // Sign the manifest of a release, that binds it's version to the
+    // checksums of the binaries
+    //
+    case "sign-release":
+      if flag.NArg() < 3 {
+        fmt.Println("Missing release version or files")
+        help()
+      }
+
+      version, err := ParseSemVer(strings.TrimPrefix(flag.Arg(1), "v"))
+      if err != nil {
+        die(err.Error())
+      }
+      manifestPath, err := SignRelease(*version, flag.Args()[2:], loadPrivateKey(*fKey))
+      if err != nil {
+        die(err.Error())
+      }
+      complete("Release manifest saved on " + manifestPath + ", publish it along with " + manifestPath + ".sig")
+
+    //
+    // Endorse a new signing key with the current one
+    //
+    case "endorse":
+      if flag.NArg() < 2 {
+        fmt.Println("Missing public key to endorse")
+        help()
+      }
+
+      // The old key stays trusted until the (optional) retirement date
+      retireAfter := ""
+      if flag.NArg() > 2 {
+        retireAfter = flag.Arg(2)
+      }
+
+      rotationsPath := getRegistryPath(*fRegistry) + ".keys"
+      err := EndorseKey(rotationsPath, flag.Arg(1), loadPrivateKey(*fKey), retireAfter)
+      if err != nil {
+        die(err.Error())
+      }
+      complete("Key rotation saved on " + rotationsPath)
+
+    //
+    // Check the tool definitions in the tools folder
+    //
+    case "lint":
+      if *fFormat != "text" && *fFormat != "json" {
+        die(fmt.Sprintf("unknown output format '%s'", *fFormat))
+      }
+
+      findings, err := LintRegistryFolder(*fRegistryFolder)
+      if err != nil {
+        die(err.Error())
+      }
+
+      if *fFormat == "json" {
+        out, err := findings.JSON()
+        if err != nil {
+          die(err.Error())
+        }
+        fmt.Println(out)
+      } else if len(findings) > 0 {
+        fmt.Println(findings.Text())
+      }
+
+      // Only the errors fail the lint, so CI can use the exit code
+      if findings.HasErrors() {
+        os.Exit(1)
+      }
+      if *fFormat == "text" {
+        complete(fmt.Sprintf("%s has no errors", *fRegistryFolder))
+      }
+
+    //
+    // Fill the missing source checksums in the tools folder
+    //
+    case "checksum":
+      report, err := FillChecksums(*fRegistryFolder)
+      if err != nil {
+        die(err.Error())
+      }
+
+      if len(report.Problems) > 0 {
+        fmt.Println(report.Problems.Text())
+        die(fmt.Sprintf("%d checksums filled, %d verified and %d problems",
+          report.Filled, report.Verified, len(report.Problems)))
+      }
+      complete(fmt.Sprintf("%d checksums filled and %d verified", report.Filled, report.Verified))
+
+    //
+    // Create the skeleton of a new tool or version
+    //
+    case "new":
+      switch flag.Arg(1) {
+        case "tool":
+          if flag.NArg() < 3 {
+            fmt.Println("Missing tool name")
+            help()
+          }
+
+          // Ask for anything that is not given
+          desc := strings.Join(flag.Args()[3:], " ")
+          if desc == "" {
+            desc = InputPrompt("Description: ")
+          }
+          topics := *fTopics
+          if topics == "" && flag.NArg() < 4 {
+            topics = InputPrompt("Topics (comma separated): ")
+          }
+          var topicList []string
+          for _, topic := range strings.Split(topics, ",") {
+            if topic = strings.TrimSpace(topic); topic != "" {
+              topicList = append(topicList, topic)
+            }
+          }
+
+          file, err := NewTool(*fRegistryFolder, flag.Arg(2), desc, topicList)
+          if err != nil {
+            die(err.Error())
+          }
+          complete("Tool saved on " + file + ", add a version with `new version`")
+
+        case "version":
+          if flag.NArg() < 4 {
+            fmt.Println("Missing tool name or version")
+            help()
+          }
+
+          file, err := NewVersion(*fRegistryFolder, flag.Arg(2), flag.Arg(3), ScaffoldOptions{
+            Artifact: *fArtifact,
+            Interpreter: *fInterpreter,
+            Source: *fSource,
+          })
+          if err != nil {
+            die(err.Error())
+          }
+          complete("Version saved on " + file + ", fill the checksums with `checksum`")
+
+        default:
+          fmt.Println("Expecting `new tool` or `new version`")
+          help()
+      }
+
+    //
+    // Generate a new signing key pair
+    //
+    case "keygen":
+      publicPath := "public.pem"
+      if flag.NArg() > 1 {
+        publicPath = flag.Arg(1)
+      }
+      algorithm := "rsa"
+      if flag.NArg() > 2 {
+        algorithm = flag.Arg(2)
+      }
+
+      // Never overwrite an existing key
+      privatePath := getPrivateKeyPath(*fKey)
+      for _, path := range []string{privatePath, publicPath} {
+        if _, err := os.Stat(path); err == nil {
+          die(path + " already exists")
+        }
+      }
+
+      // The private key is always encrypted
+      passwd, err := PasswordPrompt("Key Password: ")
+      if err != nil {
+        die(err.Error())
+      }
+      confirm, err := PasswordPrompt("Confirm Password: ")
+      if err != nil {
+        die(err.Error())
+      }
+      if len(passwd) == 0 {
+        die("the password cannot be empty")
+      }
+      if string(passwd) != string(confirm) {
+        die("the passwords do not match")
+      }
+
+      key, err := GenerateKey(algorithm)
+      if err != nil {
+        die(err.Error())
+      }
+      privatePEM, err := EncryptedPrivateKeyPEM(key, passwd)
+      if err != nil {
+        die(err.Error())
+      }
+      publicPEM, err := PublicKeyPEM(key)
+      if err != nil {
+        die(err.Error())
+      }
+
+      if err := ioutil.WriteFile(privatePath, privatePEM, 0600); err != nil {
+        die(err.Error())
+      }
+      if err := ioutil.WriteFile(publicPath, publicPEM, 0644); err != nil {
+        die(err.Error())
+      }
+      fmt.Printf("Key ID: %s\n", KeyID(key.Public()))
+      complete("Private key saved on " + privatePath + " and public key on " + publicPath)
+
+    //
+    // Verify the registry and it's signature the way the clients do
+    //
+    case "verify":
+      publicPath := "public.pem"
+      if flag.NArg() > 1 {
+        publicPath = flag.Arg(1)
+      }
+
+      keysPEM, err := ioutil.ReadFile(publicPath)
+      if err != nil {
+        die("unable to load public key: " + err.Error())
+      }
+      keys, err := ParseKeyringPEM(keysPEM)
+      if err != nil {
+        die(err.Error())
+      }
+
+      // This also applies the key rotations published next to the registry
+      registryPath := getRegistryPath(*fRegistry)
+      reg, err := registry.VerifiedRegistryFromDisk(registryPath, keys, "")
+      if err != nil {
+        die(err.Error())
+      }
+      complete(fmt.Sprintf("%s is valid, with %d tools (schema version %d)",
+        registryPath, len(reg.Tools), reg.Version))
 
     ///
     /// Show the version
@@ -0,0 +1,177 @@
+package main
+
+import (
+  "bytes"
+  "crypto/aes"
+  "crypto/cipher"
+  "crypto/rand"
+  "crypto/sha256"
+  "crypto/x509/pkix"
+  "encoding/asn1"
+  "fmt"
+  "golang.org/x/crypto/pbkdf2"
+)
+
+/**
+ * The PBES2 object identifiers (see RFC 8018)
+ */
+var (
+  oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+  oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+  oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+  oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+  oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+  oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+/**
+ * The PBKDF2 iterations used for the new keys
+ */
+const pbkdf2Iterations = 600000
+
+/**
+ * The ASN.1 structures of an encrypted PKCS#8 private key
+ */
+type encryptedPrivateKeyInfo struct {
+  Algorithm       pkix.AlgorithmIdentifier
+  EncryptedData   []byte
+}
+type pbes2Params struct {
+  KeyDerivationFunc   pkix.AlgorithmIdentifier
+  EncryptionScheme    pkix.AlgorithmIdentifier
+}
+type pbkdf2Params struct {
+  Salt          []byte
+  Iterations    int
+  KeyLength     int                       `asn1:"optional"`
+  PRF           pkix.AlgorithmIdentifier  `asn1:"optional"`
+}
+
+/**
+ * Return the key size of an AES-CBC encryption scheme
+ */
+func aesKeySize(oid asn1.ObjectIdentifier) int {
+  switch {
+    case oid.Equal(oidAES128CBC):
+      return 16
+    case oid.Equal(oidAES192CBC):
+      return 24
+    case oid.Equal(oidAES256CBC):
+      return 32
+  }
+  return 0
+}
+
+/**
+ * Wrap a value in the parameters of an algorithm identifier
+ */
+func algorithmWith(oid asn1.ObjectIdentifier, params interface{}) (pkix.AlgorithmIdentifier, error) {
+  byt, err := asn1.Marshal(params)
+  if err != nil {
+    return pkix.AlgorithmIdentifier{}, err
+  }
+  return pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.RawValue{FullBytes: byt}}, nil
+}
+
+/**
+ * Encrypt a PKCS#8 private key with PBES2, deriving an AES-256-CBC key from
+ * the password with PBKDF2-HMAC-SHA256. This is the `ENCRYPTED PRIVATE KEY`
+ * format that openssl also creates and reads.
+ */
+func EncryptPKCS8PrivateKey(der []byte, passwd []byte) ([]byte, error) {
+  salt := make([]byte, 16)
+  iv := make([]byte, aes.BlockSize)
+  if _, err := rand.Read(salt); err != nil {
+    return nil, err
+  }
+  if _, err := rand.Read(iv); err != nil {
+    return nil, err
+  }
+
+  kdf, err := algorithmWith(oidPBKDF2, pbkdf2Params{
+    Salt: salt,
+    Iterations: pbkdf2Iterations,
+    KeyLength: 32,
+    PRF: pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+  })
+  if err != nil {
+    return nil, err
+  }
+  scheme, err := algorithmWith(oidAES256CBC, iv)
+  if err != nil {
+    return nil, err
+  }
+  algorithm, err := algorithmWith(oidPBES2, pbes2Params{kdf, scheme})
+  if err != nil {
+    return nil, err
+  }
+
+  // Pad to the block size, as given by PKCS#7
+  padding := aes.BlockSize - len(der) % aes.BlockSize
+  plain := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+  block, err := aes.NewCipher(pbkdf2.Key(passwd, salt, pbkdf2Iterations, 32, sha256.New))
+  if err != nil {
+    return nil, err
+  }
+  encrypted := make([]byte, len(plain))
+  cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+
+  return asn1.Marshal(encryptedPrivateKeyInfo{algorithm, encrypted})
+}
+
+/**
+ * Decrypt a PKCS#8 private key encrypted with PBES2, using PBKDF2-HMAC-SHA256
+ * and AES-CBC, returning the DER encoded PKCS#8 key
+ */
+func DecryptPKCS8PrivateKey(der []byte, passwd []byte) ([]byte, error) {
+  var info encryptedPrivateKeyInfo
+  if _, err := asn1.Unmarshal(der, &info); err != nil {
+    return nil, fmt.Errorf("invalid encrypted private key: %s", err.Error())
+  }
+  if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+    return nil, fmt.Errorf("unsupported private key encryption %s, expecting PBES2", info.Algorithm.Algorithm)
+  }
+
+  var params pbes2Params
+  if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+    return nil, fmt.Errorf("invalid encrypted private key: %s", err.Error())
+  }
+  if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+    return nil, fmt.Errorf("unsupported private key derivation %s, expecting PBKDF2", params.KeyDerivationFunc.Algorithm)
+  }
+  var kdf pbkdf2Params
+  if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+    return nil, fmt.Errorf("invalid encrypted private key: %s", err.Error())
+  }
+  if !kdf.PRF.Algorithm.Equal(oidHMACWithSHA256) {
+    return nil, fmt.Errorf("unsupported private key derivation function, expecting HMAC-SHA256")
+  }
+  keySize := aesKeySize(params.EncryptionScheme.Algorithm)
+  if keySize == 0 {
+    return nil, fmt.Errorf("unsupported private key cipher %s, expecting AES-CBC", params.EncryptionScheme.Algorithm)
+  }
+  var iv []byte
+  if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+    return nil, fmt.Errorf("invalid encrypted private key: bad IV")
+  }
+
+  encrypted := info.EncryptedData
+  if len(encrypted) == 0 || len(encrypted) % aes.BlockSize != 0 {
+    return nil, fmt.Errorf("invalid encrypted private key: bad length")
+  }
+  block, err := aes.NewCipher(pbkdf2.Key(passwd, kdf.Salt, kdf.Iterations, keySize, sha256.New))
+  if err != nil {
+    return nil, err
+  }
+  plain := make([]byte, len(encrypted))
+  cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, encrypted)
+
+  // A wrong password shows up as a broken padding
+  padding := int(plain[len(plain) - 1])
+  if padding == 0 || padding > aes.BlockSize ||
+      !bytes.Equal(plain[len(plain) - padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+    return nil, fmt.Errorf("incorrect password")
+  }
+  return plain[:len(plain) - padding], nil
+}
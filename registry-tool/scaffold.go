@@ -0,0 +1,357 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "regexp"
+  "strings"
+  "gopkg.in/yaml.v3"
+  . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
+)
+
+/**
+ * What to put in a new version skeleton
+ */
+type ScaffoldOptions struct {
+  // The artifact type (docker, file, tar or git). If missing, the artifacts
+  // of the previous version are copied, or the type is asked for if there is
+  // no previous version.
+  Artifact      string
+
+  // The interpreter of the executable artifacts (python, shell or java), or
+  // empty for binaries
+  Interpreter   string
+
+  // The source URL, or the image of docker artifacts
+  Source        string
+}
+
+/**
+ * The artifact types there is a skeleton for
+ */
+var artifactTypes = []string{"docker", "file", "tar", "git"}
+
+/**
+ * The skeletons of the interpreter blocks, along with the entrypoint. The
+ * `TOOL` is replaced with the name of the tool.
+ */
+var interpreterSkeletons = map[string]string{
+  "python": "    entrypoint: main.py\n    interpreter:\n      python: python3\n",
+  "shell": "    entrypoint: run.sh\n    interpreter:\n      shell: sh\n",
+  "java": "    entrypoint: TOOL.jar\n    interpreter:\n      java: java\n",
+}
+
+/**
+ * Return the string as a YAML scalar, quoted if it would otherwise be parsed
+ * as something else (eg. a number)
+ */
+func yamlScalar(value string) string {
+  byt, err := yaml.Marshal(value)
+  if err != nil {
+    return fmt.Sprintf("%q", value)
+  }
+  return strings.TrimSpace(string(byt))
+}
+
+/**
+ * Check that the tool name can be used as a folder and in `ss add`
+ */
+func checkToolName(name string) error {
+  if name == "" || strings.ContainsAny(name, "/@ \t") || strings.HasPrefix(name, ".") {
+    return fmt.Errorf("invalid tool name '%s'", name)
+  }
+  return nil
+}
+
+/**
+ * Create the folder and `package.yml` of a new tool
+ */
+func NewTool(folder string, name string, desc string, topics []string) (string, error) {
+  if err := checkToolName(name); err != nil {
+    return "", err
+  }
+  if strings.TrimSpace(desc) == "" {
+    return "", fmt.Errorf("the tool needs a description")
+  }
+
+  toolFolder := folder + "/" + name
+  if _, err := os.Stat(toolFolder); err == nil {
+    return "", fmt.Errorf("tool '%s' already exists in %s", name, folder)
+  }
+
+  var buf bytes.Buffer
+  fmt.Fprintf(&buf, "desc: %s\n", yamlScalar(desc))
+  fmt.Fprintf(&buf, "help:\n  text: %s\n", yamlScalar(desc))
+  if len(topics) == 0 {
+    buf.WriteString("topics: []\n")
+  } else {
+    buf.WriteString("topics:\n")
+    for _, topic := range topics {
+      fmt.Fprintf(&buf, "  - %s\n", yamlScalar(topic))
+    }
+  }
+
+  if err := os.MkdirAll(toolFolder, 0755); err != nil {
+    return "", err
+  }
+  packageFile := toolFolder + "/package.yml"
+  return packageFile, ioutil.WriteFile(packageFile, buf.Bytes(), 0644)
+}
+
+/**
+ * Create the version file of a tool, either from the skeleton of the given
+ * artifact type, or from the artifacts of the previous version. Without a
+ * previous version, the artifact type of the skeleton is asked for.
+ */
+func NewVersion(folder string, name string, versionStr string, opts ScaffoldOptions) (string, error) {
+  toolFolder := folder + "/" + name
+  if _, err := os.Stat(toolFolder + "/package.yml"); err != nil {
+    return "", fmt.Errorf("tool '%s' does not exist in %s, create it with `new tool`", name, folder)
+  }
+
+  version, err := ParseSemVer(versionStr)
+  if err != nil {
+    return "", err
+  }
+  versionFile := toolFolder + "/" + version.ToString() + ".yml"
+  if _, err := os.Stat(versionFile); err == nil {
+    return "", fmt.Errorf("version %s of '%s' already exists", version.ToString(), name)
+  }
+
+  var contents []byte
+  var previous *SemVer = nil
+  if opts.Artifact == "" {
+    previous, err = previousVersion(toolFolder, *version)
+    if err != nil {
+      return "", err
+    }
+    if previous == nil {
+      fmt.Printf("There is no version of '%s' older than %s to copy\n", name, version.ToString())
+      opts.Artifact = InputPrompt("Artifact type (docker, file, tar or git): ")
+    }
+  }
+
+  if previous != nil {
+    contents, err = copyVersion(toolFolder + "/" + previous.ToString() + ".yml", *previous, *version)
+  } else {
+    contents, err = versionSkeleton(name, *version, opts)
+  }
+  if err != nil {
+    return "", err
+  }
+
+  return versionFile, ioutil.WriteFile(versionFile, contents, 0644)
+}
+
+/**
+ * Find the latest version of the tool that is older than the given one, or
+ * nil if there is none
+ */
+func previousVersion(toolFolder string, version SemVer) (*SemVer, error) {
+  var older *SemVer = nil
+
+  files, err := ioutil.ReadDir(toolFolder)
+  if err != nil {
+    return nil, err
+  }
+  for _, f := range files {
+    fileName := f.Name()
+    if fileName == "package.yml" || !strings.HasSuffix(fileName, ".yml") {
+      continue
+    }
+    ver, err := ParseSemVer(fileName[:len(fileName) - 4])
+    if err != nil {
+      continue
+    }
+    if ver.LessThan(&version) && (older == nil || ver.GreaterThan(older)) {
+      older = ver
+    }
+  }
+
+  return older, nil
+}
+
+/**
+ * Generate the skeleton of a version with a single artifact
+ */
+func versionSkeleton(name string, version SemVer, opts ScaffoldOptions) ([]byte, error) {
+  var buf bytes.Buffer
+
+  if !oneOf(opts.Artifact, artifactTypes) {
+    return nil, fmt.Errorf("unknown artifact type '%s', expecting docker, file, tar or git", opts.Artifact)
+  }
+
+  interpreter := ""
+  if opts.Interpreter != "" {
+    skeleton, ok := interpreterSkeletons[opts.Interpreter]
+    if !ok {
+      return nil, fmt.Errorf("unknown interpreter '%s', expecting python, shell or java", opts.Interpreter)
+    }
+    if opts.Artifact == "docker" {
+      return nil, fmt.Errorf("docker artifacts have no interpreter")
+    }
+    interpreter = strings.Replace(skeleton, "TOOL", name, -1)
+  }
+
+  source := opts.Source
+  if source == "" {
+    if opts.Artifact == "docker" {
+      source = InputPrompt("Docker image: ")
+    } else {
+      source = InputPrompt("Source URL: ")
+    }
+    if source == "" {
+      return nil, fmt.Errorf("missing the source of the artifact")
+    }
+  }
+
+  buf.WriteString("artifacts:\n")
+  switch opts.Artifact {
+    case "docker":
+      buf.WriteString("  - type: docker\n")
+      fmt.Fprintf(&buf, "    image: %s\n", yamlScalar(source))
+      fmt.Fprintf(&buf, "    tag: %s\n", yamlScalar(version.ToString()))
+      return buf.Bytes(), nil
+
+    case "file", "tar":
+      sourceType := "file"
+      if opts.Artifact == "tar" {
+        sourceType = "archive/tar"
+      }
+      buf.WriteString("  - type: executable\n")
+      buf.WriteString("    source:\n")
+      fmt.Fprintf(&buf, "      type: %s\n", sourceType)
+      fmt.Fprintf(&buf, "      url: %s\n", yamlScalar(source))
+      buf.WriteString("      # Filled by `registry-tool checksum`\n")
+      buf.WriteString("      checksum: \"\"\n")
+
+    case "git":
+      buf.WriteString("  - type: executable\n")
+      buf.WriteString("    source:\n")
+      buf.WriteString("      type: vcs/git\n")
+      fmt.Fprintf(&buf, "      url: %s\n", yamlScalar(source))
+      fmt.Fprintf(&buf, "      branch: %s\n", yamlScalar(version.ToString()))
+  }
+
+  // Binaries only run on the system they are built for
+  if interpreter != "" {
+    buf.WriteString(interpreter)
+  } else {
+    if opts.Artifact == "tar" {
+      fmt.Fprintf(&buf, "    entrypoint: %s\n", name)
+    }
+    buf.WriteString("    platform: \"*\"\n")
+    buf.WriteString("    arch: \"*\"\n")
+  }
+
+  return buf.Bytes(), nil
+}
+
+/**
+ * Replace the occurrences of the previous version in the value that are not
+ * part of a longer version (eg. `11.2.3` or `1.2.30` for `1.2.3`). A trailing
+ * dot is allowed, if it's not followed by a digit (eg. `v1.2.3.tar.gz`).
+ */
+func replaceVersion(value string, previous string, version string) string {
+  matcher := regexp.MustCompile(regexp.QuoteMeta(previous))
+
+  var buf strings.Builder
+  last := 0
+  for _, match := range matcher.FindAllStringIndex(value, -1) {
+    start, end := match[0], match[1]
+    if start > 0 && (isDigit(value[start - 1]) || value[start - 1] == '.') {
+      continue
+    }
+    if end < len(value) && isDigit(value[end]) {
+      continue
+    }
+    if end + 1 < len(value) && value[end] == '.' && isDigit(value[end + 1]) {
+      continue
+    }
+    buf.WriteString(value[last:start])
+    buf.WriteString(version)
+    last = end
+  }
+  buf.WriteString(value[last:])
+  return buf.String()
+}
+
+/**
+ * Check if the character is a decimal digit
+ */
+func isDigit(c byte) bool {
+  return c >= '0' && c <= '9'
+}
+
+/**
+ * Replace the previous version in the scalars of the node (eg. in the URLs
+ * or the docker tags) with the new one, and clear the checksums that are
+ * no longer valid
+ */
+func updateVersionNode(node *yaml.Node, previous string, version string) {
+  if node.Kind == yaml.MappingNode {
+    for i := 0; i + 1 < len(node.Content); i += 2 {
+      key, value := node.Content[i], node.Content[i + 1]
+      if key.Value == "checksum" && value.Kind == yaml.ScalarNode {
+        value.Value = ""
+        value.Tag = "!!str"
+        value.Style = yaml.DoubleQuotedStyle
+        continue
+      }
+      updateVersionNode(value, previous, version)
+    }
+    return
+  }
+
+  if node.Kind == yaml.ScalarNode {
+    if value := replaceVersion(node.Value, previous, version); value != node.Value {
+      node.Value = value
+      node.Tag = "!!str"
+    }
+    return
+  }
+
+  for _, child := range node.Content {
+    updateVersionNode(child, previous, version)
+  }
+}
+
+/**
+ * Copy the artifacts of the previous version file for the new version. The
+ * other keys (eg. the channel or the deprecation) only describe the previous
+ * version, so they are left out.
+ */
+func copyVersion(file string, previous SemVer, version SemVer) ([]byte, error) {
+  byt, err := ioutil.ReadFile(file)
+  if err != nil {
+    return nil, fmt.Errorf("cannot read %s: %s", file, err.Error())
+  }
+
+  root := new(yaml.Node)
+  if err := yaml.Unmarshal(byt, root); err != nil {
+    return nil, fmt.Errorf("cannot parse %s: %s", file, err.Error())
+  }
+  if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+    return nil, fmt.Errorf("cannot parse %s: not a version definition", file)
+  }
+
+  // Keep only the artifacts
+  doc := root.Content[0]
+  key, artifacts := mappingValue(doc, "artifacts")
+  if artifacts == nil {
+    return nil, fmt.Errorf("%s has no artifacts to copy", file)
+  }
+  doc.Content = []*yaml.Node{key, artifacts}
+  updateVersionNode(artifacts, previous.ToString(), version.ToString())
+
+  var buf bytes.Buffer
+  encoder := yaml.NewEncoder(&buf)
+  encoder.SetIndent(2)
+  if err := encoder.Encode(root); err != nil {
+    return nil, err
+  }
+  encoder.Close()
+  return buf.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+  "bytes"
+  "testing"
+  "gopkg.in/yaml.v3"
+)
+
+func TestReplaceVersion(t *testing.T) {
+  tests := []struct {
+    value       string
+    expected    string
+  }{
+    {"1.2.3", "1.3.0"},
+    {"v1.2.3", "v1.3.0"},
+    {"https://example.com/v1.2.3/tool-1.2.3.tar.gz", "https://example.com/v1.3.0/tool-1.3.0.tar.gz"},
+    {"1.2.3-alpine", "1.3.0-alpine"},
+    {"1.2.3 and 1.2.3", "1.3.0 and 1.3.0"},
+
+    // Longer versions that contain the previous one
+    {"11.2.3", "11.2.3"},
+    {"1.2.30", "1.2.30"},
+    {"1.2.3.4", "1.2.3.4"},
+    {"0.1.2.3", "0.1.2.3"},
+    {"11.2.3 but 1.2.3", "11.2.3 but 1.3.0"},
+  }
+
+  for _, test := range tests {
+    if actual := replaceVersion(test.value, "1.2.3", "1.3.0"); actual != test.expected {
+      t.Errorf("'%s': expected '%s', got '%s'", test.value, test.expected, actual)
+    }
+  }
+}
+
+func TestUpdateVersionNode(t *testing.T) {
+  tests := []struct {
+    name        string
+    artifacts   string
+    expected    string
+  }{
+    {
+      "docker tag",
+      "- type: docker\n  image: tool\n  tag: 1.2.3\n",
+      "- type: docker\n  image: tool\n  tag: 1.3.0\n",
+    },
+    {
+      "source URL and checksum",
+      "- type: executable\n  source:\n    type: archive/tar\n    url: https://example.com/v1.2.3/tool-1.2.3.tar.gz\n    checksum: abcdef\n",
+      "- type: executable\n  source:\n    type: archive/tar\n    url: https://example.com/v1.3.0/tool-1.3.0.tar.gz\n    checksum: \"\"\n",
+    },
+    {
+      "unrelated versions",
+      "- type: docker\n  image: tool-11.2.3\n  tag: 1.2.30\n  arguments: --api 11.2.3\n",
+      "- type: docker\n  image: tool-11.2.3\n  tag: 1.2.30\n  arguments: --api 11.2.3\n",
+    },
+    {
+      "git branch",
+      "- type: executable\n  source:\n    type: vcs/git\n    url: https://example.com/tool.git\n    branch: release-1.2.3\n",
+      "- type: executable\n  source:\n    type: vcs/git\n    url: https://example.com/tool.git\n    branch: release-1.3.0\n",
+    },
+  }
+
+  for _, test := range tests {
+    root := new(yaml.Node)
+    if err := yaml.Unmarshal([]byte(test.artifacts), root); err != nil {
+      t.Fatalf("%s: %s", test.name, err.Error())
+    }
+    updateVersionNode(root, "1.2.3", "1.3.0")
+
+    var buf bytes.Buffer
+    encoder := yaml.NewEncoder(&buf)
+    encoder.SetIndent(2)
+    if err := encoder.Encode(root); err != nil {
+      t.Fatalf("%s: %s", test.name, err.Error())
+    }
+    encoder.Close()
+
+    if buf.String() != test.expected {
+      t.Errorf("%s: expected:\n%s\ngot:\n%s", test.name, test.expected, buf.String())
+    }
+  }
+}
@@ -88,7 +88,7 @@ func LoadToolFromFolder(folder string) (*registry.ToolInfo, error) {
     }
 
     verStr := fileName[:len(fileName) - 4]
-    version, err := VersionFromString(verStr)
+    version, err := ParseSemVer(verStr)
     if err != nil {
       return nil, fmt.Errorf("unexpected file '%s' in %s: %s", fileName, folder, err.Error())
     }
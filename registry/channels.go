@@ -0,0 +1,129 @@
+package registry
+
+import (
+  "fmt"
+  . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
+)
+
+/**
+ * The known release channels, from the most to the least stable one. Every
+ * channel includes the versions of the channels before it.
+ */
+var Channels = []string{"stable", "beta", "alpha"}
+
+/**
+ * The channel used when nothing is configured
+ */
+const DefaultChannel = "stable"
+
+/**
+ * Return the position of the channel in the known channels, or -1
+ */
+func channelIndex(channel string) int {
+  for idx, name := range Channels {
+    if name == channel {
+      return idx
+    }
+  }
+  return -1
+}
+
+/**
+ * Check if the channel name is valid
+ */
+func CheckChannel(channel string) error {
+  if channelIndex(channel) < 0 {
+    return fmt.Errorf("unknown channel '%s' (expecting one of %v)", channel, Channels)
+  }
+  return nil
+}
+
+/**
+ * Get the release channel of the version
+ */
+func (v ToolVersion) GetChannel() string {
+  if v.Channel == "" {
+    return DefaultChannel
+  }
+  return v.Channel
+}
+
+/**
+ * Check if the version is published in the given channel
+ */
+func (v ToolVersion) InChannel(channel string) bool {
+  if v.GetChannel() == channel {
+    return true
+  }
+  verIdx := channelIndex(v.GetChannel())
+  return verIdx >= 0 && verIdx <= channelIndex(channel)
+}
+
+/**
+ * Return a short description of the problems of the version, or an empty
+ * string if there are none
+ */
+func (v ToolVersion) Warning() string {
+  if v.Yanked {
+    if v.YankedReason != "" {
+      return "yanked: " + v.YankedReason
+    }
+    return "yanked"
+  }
+  if v.Deprecated != "" {
+    return "deprecated: " + v.Deprecated
+  }
+  return ""
+}
+
+/**
+ * Pick the version to install for the given version constraint, or the
+ * latest version if the constraint is empty. Yanked versions are never picked,
+ * and only the versions of the given channel are considered, unless a
+ * specific version is requested.
+ */
+func (v ToolVersions) Select(version string, channel string) (*ToolVersion, error) {
+  if version == "" {
+    version = "*"
+  }
+  constraint, err := ParseVersionConstraint(version)
+  if err != nil {
+    return nil, err
+  }
+
+  var found *ToolVersion = nil
+  var yanked *ToolVersion = nil
+  for idx, ver := range v {
+
+    // Pre-releases are expected in the less stable channels
+    matches := constraint.Check(ver.Version)
+    if !matches && ver.GetChannel() != DefaultChannel {
+      matches = constraint.CheckIncludingPrereleases(ver.Version)
+    }
+    if !matches {
+      continue
+    }
+    if !constraint.IsExact() && !ver.InChannel(channel) {
+      continue
+    }
+    if ver.Yanked {
+      yanked = &v[idx]
+      continue
+    }
+    if found == nil || ver.Version.GreaterThan(&found.Version) {
+      found = &v[idx]
+    }
+  }
+
+  if found == nil && yanked != nil {
+    return nil, fmt.Errorf("version %s was %s", yanked.ToString(), yanked.Warning())
+  }
+  if found == nil {
+    if version == "*" {
+      return nil, fmt.Errorf("no version found in the '%s' channel", channel)
+    }
+    return nil, fmt.Errorf("version %s not found in the '%s' channel", version, channel)
+  }
+
+  return found, nil
+}
@@ -0,0 +1,181 @@
+package registry
+
+import (
+  "fmt"
+  "strings"
+  "time"
+  . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
+)
+
+/**
+ * A named registry source, as configured by the user
+ */
+type RegistrySource struct {
+  Name        string
+  URL         string
+  Keys        *Keyring
+}
+
+/**
+ * A registry loaded from a particular source
+ */
+type NamedRegistry struct {
+  Name        string
+  *Registry
+}
+
+/**
+ * An ordered set of registries. When the same tool is found in more than one
+ * registry, the registry that comes first takes precedence.
+ */
+type RegistrySet struct {
+  Registries  []NamedRegistry
+
+  // The registries that could not be refreshed, so their cached copy is used
+  Stale       []StaleRegistry
+}
+
+/**
+ * A registry that is used from the cache, because it could not be refreshed
+ */
+type StaleRegistry struct {
+  Name        string
+  CachedAt    time.Time
+  Err         error
+}
+
+/**
+ * A tool, as resolved from a registry set
+ */
+type RegistryTool struct {
+  ToolInfo
+  Name        string
+  Registry    string
+}
+
+/**
+ * Return the path to the cache file of this registry source
+ */
+func (s RegistrySource) CacheFile(cachePath string) string {
+  return fmt.Sprintf("%s/registry-%s.json", cachePath, s.Name)
+}
+
+/**
+ * Return the keys that are trusted after applying the cached key rotations
+ * of this source on the given keys
+ */
+func (s RegistrySource) RotatedKeys(cachePath string, keys *Keyring) (*Keyring, error) {
+  registryFile := s.CacheFile(cachePath)
+  return trustedKeys(keys, readFileOrNil(registryFile + ".keys"), RotationStateFile(registryFile))
+}
+
+/**
+ * Split a `[registry/]tool` expression into it's registry and tool parts
+ */
+func SplitToolName(name string) (string, string) {
+  parts := strings.SplitN(name, "/", 2)
+  if len(parts) == 1 {
+    return "", name
+  }
+  return parts[0], parts[1]
+}
+
+/**
+ * Load (or refresh) all the registries in the given sources
+ */
+func GetRegistrySet(cachePath string, sources []RegistrySource, opts FetchOptions) (*RegistrySet, error) {
+  set := new(RegistrySet)
+  for _, source := range sources {
+    reg, err := GetRegistry(cachePath, source, opts)
+    if err != nil {
+
+      // Use the last verified copy if we could not get a fresh one
+      cached, cachedAt, cacheErr := CachedRegistry(cachePath, source)
+      if cacheErr != nil {
+        return nil, fmt.Errorf("%s: %s", source.Name, err.Error())
+      }
+      set.Stale = append(set.Stale, StaleRegistry{source.Name, cachedAt, err})
+      reg = cached
+    }
+    set.Registries = append(set.Registries, NamedRegistry{source.Name, reg})
+  }
+
+  return set, nil
+}
+
+/**
+ * Ask for a fresh copy of all the registries in the given sources
+ */
+func UpdateRegistrySet(cachePath string, sources []RegistrySource, opts FetchOptions) (*RegistrySet, error) {
+  set := new(RegistrySet)
+  for _, source := range sources {
+    reg, err := UpdateRegistry(cachePath, source, opts)
+    if err != nil {
+      return nil, fmt.Errorf("%s: %s", source.Name, err.Error())
+    }
+    set.Registries = append(set.Registries, NamedRegistry{source.Name, reg})
+  }
+
+  return set, nil
+}
+
+/**
+ * Find the registry with the given name
+ */
+func (s *RegistrySet) Get(name string) *NamedRegistry {
+  for idx, reg := range s.Registries {
+    if reg.Name == name {
+      return &s.Registries[idx]
+    }
+  }
+  return nil
+}
+
+/**
+ * Find a tool, optionally qualified with the registry name (`registry/tool`).
+ * Unqualified names are resolved in the order the registries are configured.
+ */
+func (s *RegistrySet) FindTool(name string) (*RegistryTool, error) {
+  regName, tool := SplitToolName(name)
+
+  // Lookup on a specific registry
+  if regName != "" {
+    reg := s.Get(regName)
+    if reg == nil {
+      return nil, fmt.Errorf("unknown registry '%s'", regName)
+    }
+    if info, ok := reg.Tools[tool]; ok {
+      return &RegistryTool{info, tool, reg.Name}, nil
+    }
+    return nil, fmt.Errorf("could not find tool '%s' in registry '%s'", tool, regName)
+  }
+
+  // Otherwise the first registry wins
+  for _, reg := range s.Registries {
+    if info, ok := reg.Tools[tool]; ok {
+      return &RegistryTool{info, tool, reg.Name}, nil
+    }
+  }
+
+  return nil, fmt.Errorf("could not find tool '%s'", tool)
+}
+
+/**
+ * Return all the tools in the registry set. Tools that are shadowed by a
+ * registry with higher precedence are returned qualified with the name of
+ * the registry they belong to.
+ */
+func (s *RegistrySet) Tools() map[string]RegistryTool {
+  tools := make(map[string]RegistryTool)
+  for _, reg := range s.Registries {
+    for tool, info := range reg.Tools {
+      key := tool
+      if _, ok := tools[key]; ok {
+        key = reg.Name + "/" + tool
+      }
+      tools[key] = RegistryTool{info, tool, reg.Name}
+    }
+  }
+
+  return tools
+}
@@ -3,20 +3,49 @@ package registry
 import (
   "encoding/json"
   "fmt"
-  "crypto/rsa"
   "io/ioutil"
+  "net/http"
   "os"
   "time"
   . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
 )
 
 /**
- * Get or refresh registry file
+ * How the cached registries are refreshed
+ */
+type FetchOptions struct {
+  // How long a cached registry is used before checking for a newer one
+  TTL         time.Duration
+
+  // Only use the cached registries, without touching the network
+  Offline     bool
+}
+
+/**
+ * The cache validators of a downloaded registry, used for asking the server
+ * if the registry has changed since
+ */
+type CacheHeaders struct {
+  ETag          string    `json:"etag,omitempty"`
+  LastModified  string    `json:"lastModified,omitempty"`
+}
+
+/**
+ * A registry as downloaded, along with the signature that verifies it
  */
-func GetRegistry(cachePath string, registryUrl string, pub *rsa.PublicKey) (*Registry, error) {
-  var info os.FileInfo
-  var err error
+type SignedRegistry struct {
+  Contents    []byte
+  Signature   []byte
+  Headers     *CacheHeaders
+
+  // The key rotation document published next to the registry, if any
+  Rotations   []byte
+}
 
+/**
+ * Get or refresh registry file
+ */
+func GetRegistry(cachePath string, source RegistrySource, opts FetchOptions) (*Registry, error) {
   // Prepare package dir
   if _, err := os.Stat(cachePath); os.IsNotExist(err) {
     err = os.MkdirAll(cachePath, 0755)
@@ -26,24 +55,52 @@ func GetRegistry(cachePath string, registryUrl string, pub *rsa.PublicKey) (*Reg
   }
 
   // First try to load the file from disk, and if it failed, try web
-  registryFile := fmt.Sprintf("%s/registry.json", cachePath)
-  info, err = os.Stat(registryFile)
-  if err != nil {
-    return RefreshRegistry(registryFile, registryUrl, pub)
+  registryFile := source.CacheFile(cachePath)
+  if info, err := os.Stat(registryFile); err == nil {
+    if opts.Offline || time.Since(info.ModTime()) <= opts.TTL {
+      reg, err := VerifiedRegistryFromDisk(registryFile, source.Keys, RotationStateFile(registryFile))
+      if err == nil {
+        return reg, nil
+      }
+
+      // Anyone could have changed a cache that can't be verified, so we
+      // treat it as missing
+      RemoveCachedRegistry(registryFile)
+    }
   }
 
-  registryAge := time.Since(info.ModTime())
-  if registryAge > time.Hour {
-    return RefreshRegistry(registryFile, registryUrl, pub)
+  if opts.Offline {
+    return nil, fmt.Errorf("the registry is not available offline, use `ss update` when online")
   }
+  return RefreshRegistry(registryFile, source.URL, source.Keys)
+}
 
-  return RegistryFromDisk(registryFile)
+/**
+ * Load the last verified copy of the registry, and the time it was known
+ * to be the latest one
+ */
+func CachedRegistry(cachePath string, source RegistrySource) (*Registry, time.Time, error) {
+  registryFile := source.CacheFile(cachePath)
+  info, err := os.Stat(registryFile)
+  if err != nil {
+    return nil, time.Time{}, fmt.Errorf("the registry is not cached")
+  }
+
+  reg, err := VerifiedRegistryFromDisk(registryFile, source.Keys, RotationStateFile(registryFile))
+  if err != nil {
+    return nil, time.Time{}, err
+  }
+  return reg, info.ModTime(), nil
 }
 
 /**
  * Get or refresh registry file
  */
-func UpdateRegistry(cachePath string, registryUrl string, pub *rsa.PublicKey) (*Registry, error) {
+func UpdateRegistry(cachePath string, source RegistrySource, opts FetchOptions) (*Registry, error) {
+  if opts.Offline {
+    return nil, fmt.Errorf("cannot update the registry in offline mode")
+  }
+
   // Prepare package dir
   if _, err := os.Stat(cachePath); os.IsNotExist(err) {
     err = os.MkdirAll(cachePath, 0755)
@@ -52,51 +109,159 @@ func UpdateRegistry(cachePath string, registryUrl string, pub *rsa.PublicKey) (*
     }
   }
 
-  // First try to load the file from disk, and if it failed, try web
-  registryFile := fmt.Sprintf("%s/registry.json", cachePath)
-  return RefreshRegistry(registryFile, registryUrl, pub)
+  // Always ask for a fresh copy
+  return RefreshRegistry(source.CacheFile(cachePath), source.URL, source.Keys)
 }
 
 /**
- * Download a fresh registry
+ * Download a fresh registry, unless the cached one is still the latest
  */
-func RefreshRegistry(registryFile string, registryUrl string, pub *rsa.PublicKey) (*Registry, error) {
+func RefreshRegistry(registryFile string, registryUrl string, keys *Keyring) (*Registry, error) {
+  // The cache validators are only useful if we still have the registry
+  var cached *CacheHeaders = nil
+  if _, err := os.Stat(registryFile); err == nil {
+    cached = ReadCacheHeaders(registryFile)
+  }
+
   // Download the latest registry
-  reg, err := RegistryFromURL(registryUrl, pub)
+  stateFile := RotationStateFile(registryFile)
+  signed, err := DownloadRegistry(registryUrl, keys, cached, stateFile)
   if err != nil {
     return nil, fmt.Errorf("Unable to fetch registry: %s", err.Error())
   }
 
-  // Write cached version of the registry
-  err = RegistryToDisk(reg, registryFile)
-  if err != nil{
+  // If it didn't change, just mark the cached version as fresh
+  if signed == nil {
+    if reg, err := VerifiedRegistryFromDisk(registryFile, keys, stateFile); err == nil {
+      now := time.Now()
+      os.Chtimes(registryFile, now, now)
+      return reg, nil
+    }
+
+    // The cached copy is broken, so we need the whole registry after all
+    signed, err = DownloadRegistry(registryUrl, keys, nil, stateFile)
+    if err != nil {
+      return nil, fmt.Errorf("Unable to fetch registry: %s", err.Error())
+    }
+  }
+
+  reg, err := ParseRegistry(signed.Contents)
+  if err != nil {
+    return nil, err
+  }
+
+  // Keep the registry as it was signed, so it can be verified again when
+  // it's loaded from the cache
+  err = ioutil.WriteFile(registryFile, signed.Contents, 0644)
+  if err == nil {
+    err = ioutil.WriteFile(registryFile + ".sig", signed.Signature, 0644)
+  }
+  if err == nil && signed.Rotations != nil {
+    err = ioutil.WriteFile(registryFile + ".keys", signed.Rotations, 0644)
+  } else if err == nil {
+    if err = os.Remove(registryFile + ".keys"); os.IsNotExist(err) {
+      err = nil
+    }
+  }
+  if err == nil {
+    err = WriteCacheHeaders(registryFile, signed.Headers)
+  }
+  if err != nil {
     return nil, fmt.Errorf("Unable to save the new registry: %s", err.Error())
   }
 
   return reg, nil
 }
 
+/**
+ * Remove the cached registry, along with it's signature, key rotations and
+ * cache validators. The rotation state is kept, since it must outlive them.
+ */
+func RemoveCachedRegistry(registryFile string) error {
+  for _, file := range []string{registryFile, registryFile + ".sig", registryFile + ".keys", registryFile + ".headers"} {
+    if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+      return err
+    }
+  }
+  return nil
+}
+
+/**
+ * Read the cache validators stored next to the registry file, or nil
+ * if there are none
+ */
+func ReadCacheHeaders(registryFile string) *CacheHeaders {
+  byt, err := ioutil.ReadFile(registryFile + ".headers")
+  if err != nil {
+    return nil
+  }
+
+  headers := new(CacheHeaders)
+  if err := json.Unmarshal(byt, headers); err != nil {
+    return nil
+  }
+  return headers
+}
+
+/**
+ * Store the cache validators next to the registry file
+ */
+func WriteCacheHeaders(registryFile string, headers *CacheHeaders) error {
+  if headers == nil || (headers.ETag == "" && headers.LastModified == "") {
+    err := os.Remove(registryFile + ".headers")
+    if err != nil && !os.IsNotExist(err) {
+      return err
+    }
+    return nil
+  }
+
+  bytes, err := json.Marshal(headers)
+  if err != nil {
+    return err
+  }
+  return ioutil.WriteFile(registryFile + ".headers", bytes, 0644)
+}
+
+/**
+ * Return the request headers that ask for the registry only if it has
+ * changed since it was cached
+ */
+func (h *CacheHeaders) RequestHeaders() map[string]string {
+  headers := make(map[string]string)
+  if h == nil {
+    return headers
+  }
+  if h.ETag != "" {
+    headers["If-None-Match"] = h.ETag
+  }
+  if h.LastModified != "" {
+    headers["If-Modified-Since"] = h.LastModified
+  }
+  return headers
+}
+
 /**
  * Parse a JSON buffer into a registry structure
  */
 func ParseRegistry(byt []byte) (*Registry, error) {
   var reg *Registry = new(Registry)
 
-  // Parse the JSON document
-  if err := json.Unmarshal(byt, reg); err != nil {
+  // Make sure we understand this version of the registry
+  if err := ValidateRegistry(byt); err != nil {
     return nil, err
   }
 
-  // Make sure version is 1
-  if reg.Version != 1 {
-    return nil, fmt.Errorf("unsupported registry version %d", reg.Version)
+  // Parse the JSON document
+  if err := json.Unmarshal(byt, reg); err != nil {
+    return nil, err
   }
 
   return reg, nil
 }
 
 /**
- * Load registry from the disk
+ * Load registry from the disk, without verifying it (eg. a registry that is
+ * about to be signed). Use `VerifiedRegistryFromDisk` for the cached ones.
  */
 func RegistryFromDisk(s string) (*Registry, error) {
   byt, err := ioutil.ReadFile(s)
@@ -107,6 +272,91 @@ func RegistryFromDisk(s string) (*Registry, error) {
   return ParseRegistry(byt)
 }
 
+/**
+ * Return the file contents, or nil if it can't be read
+ */
+func readFileOrNil(path string) []byte {
+  byt, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil
+  }
+  return byt
+}
+
+/**
+ * Return the keys that are trusted after applying the key rotation document
+ * on the given keys. The document is self-verifying, so it's ignored if it
+ * can't be parsed, unless it replaces one we already applied. If a state file
+ * is given, the applied rotations are recorded in it.
+ */
+func trustedKeys(keys *Keyring, rotations []byte, stateFile string) (*Keyring, error) {
+  state := new(RotationState)
+  if stateFile != "" {
+    var err error
+    if state, err = LoadRotationState(stateFile); err != nil {
+      return nil, err
+    }
+  }
+  applied, retired := state.Applied, len(state.Retired)
+
+  var doc *KeyRotations = nil
+  if rotations != nil {
+    parsed, err := ParseKeyRotations(rotations)
+    if err != nil && state.Applied > 0 {
+      return nil, err
+    }
+    doc = parsed
+  }
+  trusted, err := doc.Apply(keys, time.Now(), state)
+  if err != nil {
+    return nil, err
+  }
+
+  if stateFile != "" && (state.Applied != applied || len(state.Retired) != retired) {
+    if err := state.Save(stateFile); err != nil {
+      return nil, fmt.Errorf("unable to save the key rotation state: %s", err.Error())
+    }
+  }
+  return trusted, nil
+}
+
+/**
+ * Read the signature stored next to the registry, preferring the envelope
+ * in `.sig2` over the raw signature in `.sig`
+ */
+func readRegistrySignature(s string) ([]byte, error) {
+  sig, err := ioutil.ReadFile(s + ".sig2")
+  if os.IsNotExist(err) {
+    sig, err = ioutil.ReadFile(s + ".sig")
+  }
+  return sig, err
+}
+
+/**
+ * Load a registry from the disk, verifying it against the signature that
+ * is stored next to it. The key rotations applied are recorded in the
+ * state file, if one is given.
+ */
+func VerifiedRegistryFromDisk(s string, keys *Keyring, stateFile string) (*Registry, error) {
+  byt, err := ioutil.ReadFile(s)
+  if (err != nil) {
+    return nil, fmt.Errorf("Error loading registry: %s", err.Error())
+  }
+  sig, err := readRegistrySignature(s)
+  if (err != nil) {
+    return nil, fmt.Errorf("Error loading registry signature: %s", err.Error())
+  }
+  trusted, err := trustedKeys(keys, readFileOrNil(s + ".keys"), stateFile)
+  if err != nil {
+    return nil, fmt.Errorf("Error loading registry: %s", err.Error())
+  }
+  if err := trusted.Verify(byt, sig); err != nil {
+    return nil, fmt.Errorf("Error loading registry: %s", err.Error())
+  }
+
+  return ParseRegistry(byt)
+}
+
 /**
  * Return the byte stream of the registry
  */
@@ -127,25 +377,70 @@ func RegistryToDisk(reg *Registry, s string) error {
 }
 
 /**
- * Download the registry from URL
+ * Download a file that is published next to the registry only by some of
+ * them, returning nil if the server doesn't have it. Any other failure is an
+ * error, since treating it as missing would let anyone in the way hide it.
  */
-func RegistryFromURL(s string, pub *rsa.PublicKey) (*Registry, error) {
+func downloadOptional(url string) ([]byte, error) {
+  stream := Download(url, WithDefaults)
+  if stream.Err != nil && stream.Meta.StatusCode == http.StatusNotFound {
+    stream.Close()
+    return nil, nil
+  }
+  return stream.EventuallyReadAll()
+}
 
-  // Download signature
-  byt, err := Download(s + ".sig", WithDefaults).
-              EventuallyReadAll()
+/**
+ * Download the registry from URL and verify it's signature. If the registry
+ * has not changed since the given cache validators, nil is returned. The key
+ * rotations applied are recorded in the state file, if one is given.
+ */
+func DownloadRegistry(s string, keys *Keyring, cached *CacheHeaders, stateFile string) (*SignedRegistry, error) {
+
+  // Ask for the latest version
+  stream := DownloadWithHeaders(s, cached.RequestHeaders(), WithDefaults)
+  if stream.Err != nil {
+    return nil, fmt.Errorf("download error: %s", stream.Err.Error())
+  }
+  if stream.Meta.NotModified {
+    stream.Close()
+    return nil, nil
+  }
+  headers := &CacheHeaders{stream.Meta.ETag, stream.Meta.LastModified}
+
+  // Download signature, preferring the envelope that carries the key ID and
+  // algorithm over the raw signature kept for the older clients
+  sig, err := downloadOptional(s + ".sig2")
+  if err == nil && sig == nil {
+    sig, err = Download(s + ".sig", WithDefaults).
+                EventuallyReadAll()
+  }
   if err != nil {
+    stream.Close()
     return nil, fmt.Errorf("signature error: %s", err.Error())
   }
 
-  // Download latest version
-  byt, err = Download(s, WithDefaults).
-             AndDecompressIfCompressed().
-             AndValidatePSSSignature(byt, pub).
-             EventuallyReadAll()
+  // The key rotations are optional, but only a missing document means there
+  // are none
+  rotations, err := downloadOptional(s + ".keys")
+  if err != nil {
+    stream.Close()
+    return nil, fmt.Errorf("key rotations error: %s", err.Error())
+  }
+  trusted, err := trustedKeys(keys, rotations, stateFile)
+  if err != nil {
+    stream.Close()
+    return nil, fmt.Errorf("key rotations error: %s", err.Error())
+  }
+
+  // Read the latest version
+  byt, err := stream.
+              AndDecompressIfCompressed().
+              AndValidateSignature(sig, trusted).
+              EventuallyReadAll()
   if err != nil {
     return nil, fmt.Errorf("download error: %s", err.Error())
   }
 
-  return ParseRegistry(byt)
+  return &SignedRegistry{byt, sig, headers, rotations}, nil
 }
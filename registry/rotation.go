@@ -0,0 +1,222 @@
+package registry
+
+import (
+  "crypto/sha256"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "time"
+  . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
+)
+
+/**
+ * The endorsement of a new signing key by an already trusted one. The old
+ * key stays trusted until `retireAfter`, so clients can move over while
+ * both keys are in use.
+ */
+type KeyRotation struct {
+  Key           string      `json:"key"`
+  EndorsedBy    string      `json:"endorsedBy"`
+  RetireAfter   string      `json:"retireAfter,omitempty"`
+  Signature     []byte      `json:"signature"`
+}
+
+/**
+ * The key rotation document, published next to the registry
+ */
+type KeyRotations struct {
+  Rotations     []KeyRotation   `json:"rotations"`
+}
+
+/**
+ * What the client learned from the key rotation documents of a registry. It
+ * is kept in the data dir, so a document that drops rotations we already
+ * applied (eg. an older copy served by a mirror) can't bring back the keys
+ * they retired.
+ */
+type RotationState struct {
+  // How many rotations of the document were seen, up to the last applied one
+  Applied       int         `json:"applied"`
+
+  // The digest of these rotations, so they can't be changed either
+  Digest        string      `json:"digest,omitempty"`
+
+  // The IDs of the retired keys, that are never trusted again
+  Retired       []string    `json:"retired,omitempty"`
+}
+
+/**
+ * Return the file that keeps the rotation state of a cached registry. It is
+ * not part of the cache, so it outlives the registry when it's removed.
+ */
+func RotationStateFile(registryFile string) string {
+  return registryFile + ".rotations"
+}
+
+/**
+ * Load the rotation state, or an empty one if nothing was applied yet
+ */
+func LoadRotationState(path string) (*RotationState, error) {
+  state := new(RotationState)
+  byt, err := ioutil.ReadFile(path)
+  if os.IsNotExist(err) {
+    return state, nil
+  } else if err != nil {
+    return nil, fmt.Errorf("unable to load the key rotation state: %s", err.Error())
+  }
+  if err := json.Unmarshal(byt, state); err != nil {
+    return nil, fmt.Errorf("invalid key rotation state %s: %s", path, err.Error())
+  }
+  return state, nil
+}
+
+/**
+ * Save the rotation state, replacing the previous one at once
+ */
+func (s *RotationState) Save(path string) error {
+  byt, err := json.Marshal(s)
+  if err != nil {
+    return err
+  }
+
+  tmp, err := ioutil.TempFile(filepath.Dir(path), ".rotations-")
+  if err != nil {
+    return err
+  }
+  _, err = tmp.Write(byt)
+  if closeErr := tmp.Close(); err == nil {
+    err = closeErr
+  }
+  if err == nil {
+    err = os.Rename(tmp.Name(), path)
+  }
+  if err != nil {
+    os.Remove(tmp.Name())
+  }
+  return err
+}
+
+/**
+ * Check if the key was retired by an applied rotation
+ */
+func (s *RotationState) IsRetired(id string) bool {
+  for _, retired := range s.Retired {
+    if retired == id {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Return the digest of a list of rotations
+ */
+func rotationsDigest(rotations []KeyRotation) string {
+  h := sha256.New()
+  for _, rotation := range rotations {
+    byt, _ := json.Marshal(rotation)
+    h.Write(byt)
+    h.Write([]byte("\n"))
+  }
+  return hex.EncodeToString(h.Sum(nil))
+}
+
+/**
+ * Return the payload the endorsing key signs, that binds the new key to the
+ * endorsing key and it's retirement date
+ */
+func (r KeyRotation) Payload() ([]byte, error) {
+  pub, err := ParsePublicKeyPEM([]byte(r.Key))
+  if err != nil {
+    return nil, err
+  }
+  return []byte(fmt.Sprintf("ss-key-rotation\n%s\n%s\n%s", KeyID(pub), r.EndorsedBy, r.RetireAfter)), nil
+}
+
+/**
+ * Parse a key rotation document
+ */
+func ParseKeyRotations(byt []byte) (*KeyRotations, error) {
+  doc := new(KeyRotations)
+  if err := json.Unmarshal(byt, doc); err != nil {
+    return nil, fmt.Errorf("invalid key rotation document: %s", err.Error())
+  }
+  for idx, rotation := range doc.Rotations {
+    if rotation.RetireAfter == "" {
+      continue
+    }
+    if _, err := time.Parse(time.RFC3339, rotation.RetireAfter); err != nil {
+      return nil, fmt.Errorf("invalid key rotation document: rotations[%d].retireAfter: %s", idx, err.Error())
+    }
+  }
+  return doc, nil
+}
+
+/**
+ * Return the keyring that results from applying the rotations, in order, on
+ * the trusted keys. Rotations that are not endorsed by a trusted key are
+ * ignored, and the keys past their retirement date are no longer trusted.
+ * The state is updated with the applied rotations and the retired keys, and
+ * documents that drop or change the rotations already applied are refused.
+ */
+func (doc *KeyRotations) Apply(keys *Keyring, now time.Time, state *RotationState) (*Keyring, error) {
+  trusted := keys.Clone()
+  if state == nil {
+    state = new(RotationState)
+  }
+
+  var rotations []KeyRotation = nil
+  if doc != nil {
+    rotations = doc.Rotations
+  }
+  if len(rotations) < state.Applied {
+    return nil, fmt.Errorf("the key rotation document has %d rotations, but %d were already applied",
+      len(rotations), state.Applied)
+  }
+  if state.Applied > 0 && rotationsDigest(rotations[:state.Applied]) != state.Digest {
+    return nil, fmt.Errorf("the key rotation document changes rotations that were already applied")
+  }
+
+  for idx, rotation := range rotations {
+    endorser, ok := trusted.Keys[rotation.EndorsedBy]
+    if !ok {
+      continue
+    }
+    payload, err := rotation.Payload()
+    if err != nil {
+      continue
+    }
+    endorserKeys := NewKeyring()
+    endorserKeys.Add(endorser)
+    if endorserKeys.Verify(payload, rotation.Signature) != nil {
+      continue
+    }
+
+    pub, _ := ParsePublicKeyPEM([]byte(rotation.Key))
+    trusted.Add(pub)
+    if idx + 1 > state.Applied {
+      state.Applied = idx + 1
+    }
+    if rotation.RetireAfter != "" {
+      retireAfter, _ := time.Parse(time.RFC3339, rotation.RetireAfter)
+      if now.After(retireAfter) {
+        trusted.Remove(rotation.EndorsedBy)
+        if !state.IsRetired(rotation.EndorsedBy) {
+          state.Retired = append(state.Retired, rotation.EndorsedBy)
+        }
+      }
+    }
+  }
+  if state.Applied > 0 {
+    state.Digest = rotationsDigest(rotations[:state.Applied])
+  }
+
+  // Keys retired once stay retired, even if the clock goes back
+  for _, id := range state.Retired {
+    trusted.Remove(id)
+  }
+  return trusted, nil
+}
@@ -0,0 +1,143 @@
+package registry
+
+/**
+ * The latest registry schema version this client understands
+ */
+const SchemaVersion = 2
+
+/**
+ * The JSON schema of every registry version, by version number. Version 1
+ * predates the schema, so these registries are read without validation.
+ */
+var registrySchemas = map[int]string{
+  2: registrySchemaV2,
+}
+
+const registrySchemaV2 = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["version", "tools"],
+  "additionalProperties": false,
+  "properties": {
+    "version": { "enum": [2] },
+    "toolVersion": { "$ref": "#/definitions/semver" },
+    "tools": {
+      "type": "object",
+      "additionalProperties": { "$ref": "#/definitions/tool" }
+    }
+  },
+  "definitions": {
+    "semver": {
+      "anyOf": [
+        { "type": "string", "minLength": 1 },
+        { "type": "array", "items": { "type": "integer", "minimum": 0 }, "maxItems": 3 }
+      ]
+    },
+    "tool": {
+      "type": "object",
+      "required": ["versions"],
+      "additionalProperties": false,
+      "properties": {
+        "versions": { "type": ["array", "null"], "items": { "$ref": "#/definitions/version" } },
+        "help": { "$ref": "#/definitions/help" },
+        "desc": { "type": "string" },
+        "topics": { "type": ["array", "null"], "items": { "type": "string" } }
+      }
+    },
+    "help": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "text": { "type": "string" },
+        "url": { "type": "string" },
+        "inline": { "type": "boolean" },
+        "md": { "type": "boolean" }
+      }
+    },
+    "version": {
+      "type": "object",
+      "required": ["version", "artifacts"],
+      "additionalProperties": false,
+      "properties": {
+        "version": { "$ref": "#/definitions/semver" },
+        "artifacts": { "type": ["array", "null"], "items": { "$ref": "#/definitions/artifact" } },
+        "channel": { "enum": ["stable", "beta", "alpha"] },
+        "deprecated": { "type": "string" },
+        "yanked": { "type": "boolean" },
+        "yankedReason": { "type": "string" }
+      }
+    },
+    "artifact": {
+      "type": "object",
+      "required": ["type"],
+      "additionalProperties": false,
+      "properties": {
+        "type": { "enum": ["docker", "executable"] },
+
+        "image": { "type": "string", "minLength": 1 },
+        "tag": { "type": "string" },
+        "arguments": { "type": "string" },
+        "command": { "type": "string" },
+        "setupScript": { "type": "string" },
+        "teardownScript": { "type": "string" },
+
+        "source": { "$ref": "#/definitions/source" },
+        "require": { "type": ["array", "null"], "items": { "$ref": "#/definitions/requirement" } },
+        "entrypoint": { "type": "string" },
+        "arch": { "type": "string" },
+        "platform": { "type": "string" },
+        "interpreter": { "$ref": "#/definitions/interpreter" },
+        "installScript": { "type": "string" },
+        "uninstallScript": { "type": "string" },
+        "workdir": { "type": "string" },
+        "env": { "type": ["object", "null"], "additionalProperties": { "type": "string" } }
+      }
+    },
+    "source": {
+      "type": "object",
+      "required": ["type", "url"],
+      "additionalProperties": false,
+      "properties": {
+        "type": { "enum": ["file", "archive/tar", "vcs/git"] },
+        "url": { "type": "string", "minLength": 1 },
+        "checksum": { "type": "string" },
+        "branch": { "type": "string" }
+      }
+    },
+    "requirement": {
+      "type": "object",
+      "oneOf": [
+        { "required": ["cmd"] },
+        { "required": ["exec"] },
+        { "required": ["tool"] }
+      ],
+      "dependencies": { "version": ["tool"] },
+      "additionalProperties": false,
+      "properties": {
+        "cmd": { "type": "string", "minLength": 1 },
+        "exec": { "type": "string", "minLength": 1 },
+        "tool": { "type": "string", "minLength": 1 },
+        "version": { "type": "string" }
+      }
+    },
+    "interpreter": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "shell": { "type": "string" },
+        "python": { "type": "string" },
+        "installRequirements": { "type": "string" },
+        "installPip": { "type": "string" },
+        "java": { "type": "string" },
+        "javaArgs": { "type": "string" },
+        "environment": {
+          "type": "object",
+          "additionalProperties": false,
+          "properties": {
+            "url": { "type": "string" }
+          }
+        }
+      }
+    }
+  }
+}`
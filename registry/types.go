@@ -3,8 +3,6 @@ package registry
 import (
   "encoding/json"
   "fmt"
-  "strconv"
-  "strings"
   . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
 )
 
@@ -88,10 +86,15 @@ type CommandRequirement struct {
 type ExecRequirement struct {
   Exec        string                  `json:"exec"`
 }
+type ToolRequirement struct {
+  Tool        string                  `json:"tool"`
+  Version     string                  `json:"version,omitempty"`
+}
 
 type ArtifactRequirement struct {
   *CommandRequirement
   *ExecRequirement
+  *ToolRequirement
 }
 
 type ArtifactRequirements []ArtifactRequirement
@@ -117,8 +120,8 @@ type ExecutableToolArtifact struct {
   Interpreter     *ExecutableInterpreter  `json:"interpreter,omitempty"`
   InstallScript   string                  `json:"installScript,omitempty"`
   UninstallScript string                  `json:"uninstallScript,omitempty"`
-  Workdir         string                  `json:"workdir",omitempty`
-  Environment     map[string]string       `json:"env",omitempty`
+  Workdir         string                  `json:"workdir,omitempty"`
+  Environment     map[string]string       `json:"env,omitempty"`
 
 }
 
@@ -136,8 +139,18 @@ type ToolArtifact struct {
 type ToolArtifacts []ToolArtifact
 
 type ToolVersion struct {
-  Version     VersionTriplet          `json:"version"`
+  Version     SemVer                  `json:"version"`
   Artifacts   ToolArtifacts           `json:"artifacts"`
+
+  // The release channel of the version (`stable` if missing)
+  Channel     string                  `json:"channel,omitempty"`
+
+  // If not empty, the version is deprecated with the given message
+  Deprecated  string                  `json:"deprecated,omitempty"`
+
+  // Yanked versions are broken and are never picked for installation
+  Yanked        bool                  `json:"yanked,omitempty"`
+  YankedReason  string                `json:"yankedReason,omitempty"`
 }
 
 /**
@@ -176,8 +189,8 @@ type ToolInfo struct {
  */
 type Registry struct {
   Tools       map[string] ToolInfo    `json:"tools"`
-  Version     float64                 `json:"version"`
-  ToolVersion VersionTriplet          `json:"toolVersion"`
+  Version     int                     `json:"version"`
+  ToolVersion SemVer                  `json:"toolVersion"`
 }
 
 /**
@@ -273,6 +286,32 @@ func (e *WebSource) MarshalJSON() ([]byte, error) {
 }
 
 
+/**
+ * Get the other registry tools the artifact depends on
+ */
+func (a *ToolArtifact) ToolRequirements() []ToolRequirement {
+  var reqs []ToolRequirement = nil
+  if a.ExecutableToolArtifact == nil {
+    return reqs
+  }
+  for _, req := range a.Require {
+    if req.ToolRequirement != nil {
+      reqs = append(reqs, *req.ToolRequirement)
+    }
+  }
+  return reqs
+}
+
+/**
+ * Get the tool requirement as string
+ */
+func (r ToolRequirement) ToString() string {
+  if r.Version == "" {
+    return r.Tool
+  }
+  return r.Tool + "@" + r.Version
+}
+
 /**
  * Get the version as string
  */
@@ -281,53 +320,62 @@ func (v ToolVersion) ToString() string {
 }
 
 /**
- * Get the latest version of a tool
+ * Get the latest version of a tool. Pre-releases are only considered if
+ * there are no other versions.
  */
 func (v ToolVersions) Latest() *ToolVersion {
-  var biggest float64 = v[0].Version[0] * 1000000 + v[0].Version[1] * 1000 + v[0].Version[2]
-  var found = v[0]
+  var found *ToolVersion = nil
 
-  for _, ver := range v {
-    versionNum := ver.Version[0] * 1000000 + ver.Version[1] * 1000 + ver.Version[2]
-    if versionNum > biggest {
-      found = ver
+  for idx, ver := range v {
+    if found == nil {
+      found = &v[idx]
+      continue
+    }
+    if found.Version.IsPrerelease() != ver.Version.IsPrerelease() {
+      if found.Version.IsPrerelease() {
+        found = &v[idx]
+      }
+      continue
+    }
+    if ver.Version.GreaterThan(&found.Version) {
+      found = &v[idx]
     }
   }
 
-  return &found
+  return found
 }
 
 /**
- * Find a particular version
+ * Get the exact version from the list, or nil if it's not there
  */
-func (v ToolVersions) Find(version string) (*ToolVersion, error) {
-  verFragInt := []int{}
-  verFrag := strings.Split(version, ".")
-
-  for idx, fragStr := range verFrag {
-    fragInt, err := strconv.Atoi(fragStr)
-    if err != nil {
-      return nil, fmt.Errorf("Cannot parse %d-ht component: %s", idx + 1, err.Error())
+func (v ToolVersions) Get(version SemVer) *ToolVersion {
+  for idx, ver := range v {
+    if ver.Version.Equals(version) {
+      return &v[idx]
     }
-    verFragInt = append(verFragInt, fragInt)
   }
+  return nil
+}
 
-  for _, ver := range v {
-    found := true
-
-    // Match version components
-    for idx, fragInt := range verFragInt {
-      if int(ver.Version[idx]) != fragInt {
-        found = false
-        break
-      }
-    }
+/**
+ * Find the latest version that satisfies the given version constraint
+ * (eg. `1.2`, `^1.4` or `>=1.2 <2`)
+ */
+func (v ToolVersions) Find(version string) (*ToolVersion, error) {
+  var found *ToolVersion = nil
 
-    // If found, return it
-    if found {
-      return &ver, nil
+  constraint, err := ParseVersionConstraint(version)
+  if err != nil {
+    return nil, err
+  }
+  for idx, ver := range v {
+    if constraint.Check(ver.Version) && (found == nil || ver.Version.GreaterThan(&found.Version)) {
+      found = &v[idx]
     }
   }
+  if found != nil {
+    return found, nil
+  }
 
   // Not found
   return nil, fmt.Errorf("version %s not found", version)
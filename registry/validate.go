@@ -0,0 +1,332 @@
+package registry
+
+import (
+  "encoding/json"
+  "fmt"
+  "math"
+  "sort"
+  "strings"
+)
+
+/**
+ * A JSON schema node, as decoded from the schema document
+ */
+type schemaNode map[string]interface{}
+
+/**
+ * Validates JSON documents against the subset of JSON schema used by the
+ * registry schemas
+ */
+type schemaValidator struct {
+  root        schemaNode
+  errors      []string
+}
+
+/**
+ * The problems found while validating a registry, one per field
+ */
+type ValidationError struct {
+  Errors      []string
+}
+
+func (e *ValidationError) Error() string {
+  return "invalid registry:\n  " + strings.Join(e.Errors, "\n  ")
+}
+
+/**
+ * Read the schema version of the registry document
+ */
+func registrySchemaVersion(byt []byte) (int, error) {
+  var header struct {
+    Version   interface{}     `json:"version"`
+  }
+  if err := json.Unmarshal(byt, &header); err != nil {
+    return 0, err
+  }
+
+  if header.Version == nil {
+    return 0, fmt.Errorf("missing registry version")
+  }
+  version, ok := header.Version.(float64)
+  if !ok || version != math.Trunc(version) || version < 1 {
+    return 0, fmt.Errorf("invalid registry version %v", header.Version)
+  }
+  return int(version), nil
+}
+
+/**
+ * Check the registry document against the schema of it's version. Documents
+ * of a newer version than the one we support are rejected, since we can't
+ * tell what their fields mean.
+ */
+func ValidateRegistry(byt []byte) error {
+  version, err := registrySchemaVersion(byt)
+  if err != nil {
+    return err
+  }
+  if version > SchemaVersion {
+    return fmt.Errorf("registry version %d is newer than the supported version %d, please upgrade ss (`ss upgrade`)",
+      version, SchemaVersion)
+  }
+  schemaText, ok := registrySchemas[version]
+  if !ok {
+    return nil
+  }
+
+  var schema schemaNode
+  if err := json.Unmarshal([]byte(schemaText), &schema); err != nil {
+    return fmt.Errorf("invalid registry schema %d: %s", version, err.Error())
+  }
+  var document interface{}
+  if err := json.Unmarshal(byt, &document); err != nil {
+    return err
+  }
+
+  validator := &schemaValidator{schema, nil}
+  validator.validate(schema, document, "")
+  if validator.errors != nil {
+    return &ValidationError{validator.errors}
+  }
+  return nil
+}
+
+/**
+ * Record a problem with the value at the given path
+ */
+func (v *schemaValidator) fail(path string, format string, args ...interface{}) {
+  if path == "" {
+    path = "(root)"
+  }
+  v.errors = append(v.errors, path + ": " + fmt.Sprintf(format, args...))
+}
+
+/**
+ * Resolve a `#/definitions/name` reference
+ */
+func (v *schemaValidator) resolve(ref string) schemaNode {
+  name := strings.TrimPrefix(ref, "#/definitions/")
+  if definitions, ok := v.root["definitions"].(map[string]interface{}); ok {
+    if node, ok := definitions[name].(map[string]interface{}); ok {
+      return node
+    }
+  }
+  panic("unknown schema reference " + ref)
+}
+
+/**
+ * Return the JSON schema type name of the value
+ */
+func jsonTypeOf(value interface{}) string {
+  switch typed := value.(type) {
+    case nil:
+      return "null"
+    case bool:
+      return "boolean"
+    case string:
+      return "string"
+    case float64:
+      if typed == math.Trunc(typed) {
+        return "integer"
+      }
+      return "number"
+    case []interface{}:
+      return "array"
+    case map[string]interface{}:
+      return "object"
+  }
+  return "unknown"
+}
+
+/**
+ * Check if the value is of the given type (or any of the given types)
+ */
+func matchesType(expected interface{}, value interface{}) (bool, string) {
+  actual := jsonTypeOf(value)
+
+  var names []string
+  switch typed := expected.(type) {
+    case string:
+      names = []string{typed}
+    case []interface{}:
+      for _, name := range typed {
+        names = append(names, name.(string))
+      }
+  }
+  for _, name := range names {
+    if name == actual || (name == "number" && actual == "integer") {
+      return true, ""
+    }
+  }
+  return false, strings.Join(names, " or ")
+}
+
+/**
+ * Return the sorted keys of a JSON object, so problems are always reported
+ * in the same order
+ */
+func sortedKeys(object map[string]interface{}) []string {
+  var keys []string
+  for key := range object {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+/**
+ * Join an object field to the path
+ */
+func fieldPath(path string, field string) string {
+  if path == "" {
+    return field
+  }
+  return path + "." + field
+}
+
+/**
+ * Validate the value at the given path against the schema node
+ */
+func (v *schemaValidator) validate(node schemaNode, value interface{}, path string) {
+  if ref, ok := node["$ref"].(string); ok {
+    v.validate(v.resolve(ref), value, path)
+    return
+  }
+
+  // The value must match at least one of the alternatives
+  if alternatives, ok := node["anyOf"].([]interface{}); ok {
+    for _, alternative := range alternatives {
+      probe := &schemaValidator{v.root, nil}
+      probe.validate(alternative.(map[string]interface{}), value, path)
+      if probe.errors == nil {
+        return
+      }
+    }
+    v.fail(path, "unexpected value %s", describeValue(value))
+    return
+  }
+
+  // The value must match exactly one of the alternatives
+  if alternatives, ok := node["oneOf"].([]interface{}); ok {
+    matches := 0
+    for _, alternative := range alternatives {
+      probe := &schemaValidator{v.root, nil}
+      probe.validate(alternative.(map[string]interface{}), value, path)
+      if probe.errors == nil {
+        matches++
+      }
+    }
+    if matches == 0 {
+      v.fail(path, "unexpected value %s", describeValue(value))
+      return
+    } else if matches > 1 {
+      v.fail(path, "ambiguous value %s (matches %d alternatives)", describeValue(value), matches)
+      return
+    }
+  }
+
+  if expected, ok := node["type"]; ok {
+    if ok, names := matchesType(expected, value); !ok {
+      v.fail(path, "expecting %s, found %s", names, jsonTypeOf(value))
+      return
+    }
+  }
+
+  if allowed, ok := node["enum"].([]interface{}); ok {
+    found := false
+    var names []string
+    for _, option := range allowed {
+      if option == value {
+        found = true
+      }
+      names = append(names, fmt.Sprintf("%v", option))
+    }
+    if !found {
+      v.fail(path, "unexpected value %s (expecting one of %s)", describeValue(value), strings.Join(names, ", "))
+      return
+    }
+  }
+
+  switch typed := value.(type) {
+    case string:
+      if minLength, ok := node["minLength"].(float64); ok && float64(len(typed)) < minLength {
+        v.fail(path, "must not be empty")
+      }
+
+    case float64:
+      if minimum, ok := node["minimum"].(float64); ok && typed < minimum {
+        v.fail(path, "must be at least %v", minimum)
+      }
+
+    case []interface{}:
+      if maxItems, ok := node["maxItems"].(float64); ok && float64(len(typed)) > maxItems {
+        v.fail(path, "expecting at most %v items", maxItems)
+      }
+      if items, ok := node["items"].(map[string]interface{}); ok {
+        for idx, item := range typed {
+          v.validate(items, item, fmt.Sprintf("%s[%d]", path, idx))
+        }
+      }
+
+    case map[string]interface{}:
+      v.validateObject(node, typed, path)
+  }
+}
+
+/**
+ * Validate the fields of an object
+ */
+func (v *schemaValidator) validateObject(node schemaNode, object map[string]interface{}, path string) {
+  if minProperties, ok := node["minProperties"].(float64); ok && float64(len(object)) < minProperties {
+    v.fail(path, "must not be empty")
+  }
+  if required, ok := node["required"].([]interface{}); ok {
+    for _, name := range required {
+      if _, ok := object[name.(string)]; !ok {
+        v.fail(fieldPath(path, name.(string)), "missing required field")
+      }
+    }
+  }
+
+  // Some fields are only meaningful along with others
+  if dependencies, ok := node["dependencies"].(map[string]interface{}); ok {
+    for _, key := range sortedKeys(dependencies) {
+      if _, ok := object[key]; !ok {
+        continue
+      }
+      names, _ := dependencies[key].([]interface{})
+      for _, name := range names {
+        if _, ok := object[name.(string)]; !ok {
+          v.fail(fieldPath(path, name.(string)), "missing field required by '%s'", key)
+        }
+      }
+    }
+  }
+
+  properties, _ := node["properties"].(map[string]interface{})
+  for _, key := range sortedKeys(object) {
+    if property, ok := properties[key].(map[string]interface{}); ok {
+      v.validate(property, object[key], fieldPath(path, key))
+      continue
+    }
+
+    switch additional := node["additionalProperties"].(type) {
+      case bool:
+        if !additional {
+          v.fail(fieldPath(path, key), "unknown field")
+        }
+      case map[string]interface{}:
+        v.validate(additional, object[key], fieldPath(path, key))
+    }
+  }
+}
+
+/**
+ * Describe a value for an error message
+ */
+func describeValue(value interface{}) string {
+  byt, err := json.Marshal(value)
+  if err != nil || len(byt) > 40 {
+    return jsonTypeOf(value)
+  }
+  return string(byt)
+}
@@ -0,0 +1,124 @@
+package registry
+
+import (
+  "strings"
+  "testing"
+)
+
+/**
+ * Wrap a tool version in a complete registry document
+ */
+func registryWithVersion(version string) string {
+  return `{"version": 2, "tools": {"demo": {"versions": [` + version + `]}}}`
+}
+
+/**
+ * Wrap an artifact in a complete registry document
+ */
+func registryWithArtifact(artifact string) string {
+  return registryWithVersion(`{"version": "1.0.0", "artifacts": [` + artifact + `]}`)
+}
+
+/**
+ * Wrap the requirements of an artifact in a complete registry document
+ */
+func registryWithRequirements(require string) string {
+  return registryWithArtifact(`{"type": "executable", "require": [` + require + `]}`)
+}
+
+func TestValidateRegistryAccepts(t *testing.T) {
+  tests := []string{
+    `{"version": 2, "tools": {}}`,
+    `{"version": 2, "toolVersion": "1.2.3", "tools": {}}`,
+    `{"version": 2, "toolVersion": [1, 2, 3], "tools": {}}`,
+    registryWithVersion(`{"version": [1, 0], "artifacts": null, "channel": "beta", "yanked": true}`),
+    registryWithArtifact(`{"type": "docker", "image": "alpine", "tag": "3.8"}`),
+    registryWithArtifact(`{"type": "executable", "source": {"type": "archive/tar", "url": "https://example.com/a.tgz"}}`),
+    registryWithRequirements(`{"cmd": "git"}, {"exec": "/usr/bin/git"}, {"tool": "kubectl"}`),
+    registryWithRequirements(`{"tool": "default/kubectl", "version": "^1.2"}`),
+  }
+
+  for _, test := range tests {
+    if err := ValidateRegistry([]byte(test)); err != nil {
+      t.Errorf("%s: unexpected error: %s", test, err.Error())
+    }
+  }
+}
+
+func TestValidateRegistryErrors(t *testing.T) {
+  tests := []struct {
+    document    string
+    expected    string
+  }{
+    // Registry
+    {`{"version": 2}`, "tools: missing required field"},
+    {`{"version": 2, "tools": {}, "extra": 1}`, "extra: unknown field"},
+    {`{"version": 2, "tools": []}`, "tools: expecting object, found array"},
+    {`{"version": 2, "toolVersion": [1, 2, 3, 4], "tools": {}}`, "toolVersion: unexpected value [1,2,3,4]"},
+
+    // Tools and versions
+    {`{"version": 2, "tools": {"demo": {}}}`, "tools.demo.versions: missing required field"},
+    {`{"version": 2, "tools": {"demo": {"versions": [], "desc": 1}}}`, "tools.demo.desc: expecting string, found integer"},
+    {registryWithVersion(`{"artifacts": []}`), "tools.demo.versions[0].version: missing required field"},
+    {registryWithVersion(`{"version": "1.0", "artifacts": [], "channel": "nightly"}`),
+      `tools.demo.versions[0].channel: unexpected value "nightly" (expecting one of stable, beta, alpha)`},
+
+    // Artifacts and sources
+    {registryWithArtifact(`{}`), "tools.demo.versions[0].artifacts[0].type: missing required field"},
+    {registryWithArtifact(`{"type": "docker", "image": ""}`), "tools.demo.versions[0].artifacts[0].image: must not be empty"},
+    {registryWithArtifact(`{"type": "executable", "source": {"type": "file"}}`),
+      "tools.demo.versions[0].artifacts[0].source.url: missing required field"},
+    {registryWithArtifact(`{"type": "executable", "env": {"A": 1}}`),
+      "tools.demo.versions[0].artifacts[0].env.A: expecting string, found integer"},
+
+    // Requirements
+    {registryWithRequirements(`{}`), "tools.demo.versions[0].artifacts[0].require[0]: unexpected value {}"},
+    {registryWithRequirements(`{"version": "^1.2"}`),
+      `tools.demo.versions[0].artifacts[0].require[0]: unexpected value {"version":"^1.2"}`},
+    {registryWithRequirements(`{"cmd": "git", "tool": "git"}`),
+      `tools.demo.versions[0].artifacts[0].require[0]: ambiguous value {"cmd":"git","tool":"git"} (matches 2 alternatives)`},
+    {registryWithRequirements(`{"cmd": "git", "version": "^2"}`),
+      "tools.demo.versions[0].artifacts[0].require[0].tool: missing field required by 'version'"},
+    {registryWithRequirements(`{"tool": ""}`), "tools.demo.versions[0].artifacts[0].require[0].tool: must not be empty"},
+  }
+
+  for _, test := range tests {
+    err := ValidateRegistry([]byte(test.document))
+    if err == nil {
+      t.Errorf("%s: expected an error", test.document)
+      continue
+    }
+    if !strings.Contains(err.Error(), test.expected) {
+      t.Errorf("%s: expected '%s', got '%s'", test.document, test.expected, err.Error())
+    }
+  }
+}
+
+func TestValidateRegistryVersion(t *testing.T) {
+  tests := []struct {
+    document    string
+    expected    string
+  }{
+    {`{"tools": {}}`, "missing registry version"},
+    {`{"version": "2", "tools": {}}`, "invalid registry version 2"},
+    {`{"version": 1.5, "tools": {}}`, "invalid registry version 1.5"},
+    {`{"version": 0, "tools": {}}`, "invalid registry version 0"},
+    {`{"version": 3, "tools": {}}`, "registry version 3 is newer than the supported version 2"},
+  }
+
+  for _, test := range tests {
+    err := ValidateRegistry([]byte(test.document))
+    if err == nil {
+      t.Errorf("%s: expected an error", test.document)
+      continue
+    }
+    if !strings.Contains(err.Error(), test.expected) {
+      t.Errorf("%s: expected '%s', got '%s'", test.document, test.expected, err.Error())
+    }
+  }
+
+  // Version 1 registries predate the schema
+  if err := ValidateRegistry([]byte(`{"version": 1, "tools": {"demo": {"anything": true}}}`)); err != nil {
+    t.Errorf("expected version 1 registries to be accepted, got '%s'", err.Error())
+  }
+}
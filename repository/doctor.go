@@ -0,0 +1,317 @@
+package repository
+
+import (
+  "fmt"
+  "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+/**
+ * The kinds of problems that can be found in the repository
+ */
+const (
+  ProblemOrphanedPackage      = "orphaned package"
+  ProblemMissingPackage       = "missing package"
+  ProblemBrokenState          = "broken state"
+  ProblemMissingWrapper       = "missing wrapper"
+  ProblemEmptyTool            = "empty tool"
+  ProblemStaleStaging         = "stale staging"
+  ProblemDanglingLink         = "dangling link"
+  ProblemMissingInterpreter   = "missing interpreter"
+  ProblemMissingImage         = "missing image"
+)
+
+/**
+ * A problem found in the repository
+ */
+type Problem struct {
+  Kind        string
+  Path        string
+  Message     string
+
+  // Repairs the problem, or `nil` if it cannot be repaired automatically
+  Fix         func() error
+}
+
+/**
+ * Index the artifacts of all the tools in the registries by their ID
+ */
+func IndexArtifacts(regs *registry.RegistrySet) map[string]*registry.ToolArtifact {
+  index := make(map[string]*registry.ToolArtifact)
+  if regs == nil {
+    return index
+  }
+
+  for _, reg := range regs.Registries {
+    for _, tool := range reg.Tools {
+      for _, ver := range tool.Versions {
+        for idx, _ := range ver.Artifacts {
+          artifact := &ver.Artifacts[idx]
+          index[ArtifactID(artifact)] = artifact
+        }
+      }
+    }
+  }
+
+  return index
+}
+
+/**
+ * Check the tool versions in the repository and collect the references
+ * they make to the packages
+ */
+func diagnoseTools(baseDir string, references map[string]int) []Problem {
+  var problems []Problem
+  pkgDir := baseDir + "/pkg"
+
+  folders, _ := listToolFolders(baseDir)
+  for _, f := range folders {
+    toolDir := f.Folder
+    toolName := ToolKey(f.Registry, filepath.Base(toolDir))
+
+    // Empty tool directories are left-overs of failed removals
+    versions, err := ioutil.ReadDir(toolDir)
+    if err == nil && len(versions) == 0 {
+      problems = append(problems, Problem{
+        ProblemEmptyTool,
+        toolDir,
+        fmt.Sprintf("tool '%s' has no versions installed", toolName),
+        func() error {
+          return os.Remove(toolDir)
+        },
+      })
+      continue
+    }
+
+    for _, v := range versions {
+      verStr, artifactId, ok := ParseVersionDirName(v.Name())
+      if !ok {
+        continue
+      }
+      references[artifactId] += 1
+
+      // The package must exist
+      verDir := toolDir + "/" + v.Name()
+      artifactDir := pkgDir + "/" + artifactId
+      if _, err := os.Stat(artifactDir); err != nil {
+        problems = append(problems, Problem{
+          ProblemMissingPackage,
+          verDir,
+          fmt.Sprintf("%s/%s refers to a missing package, it will be removed (use `ss add` to re-install it)",
+            toolName, verStr),
+          func() error {
+            err := os.RemoveAll(verDir)
+            if err != nil {
+              return err
+            }
+
+            // Also remove the tool if this was it's last version
+            os.Remove(toolDir)
+            return nil
+          },
+        })
+        continue
+      }
+
+      // The wrapper must exist and point to something that exists
+      if _, err := os.Stat(verDir + "/run"); err != nil {
+        problems = append(problems, Problem{
+          ProblemMissingWrapper,
+          verDir + "/run",
+          fmt.Sprintf("%s/%s has no usable `run` wrapper", toolName, verStr),
+          func() error {
+            artifact, err := ReadArtifactStateFile(artifactDir + "/.state")
+            if err != nil {
+              return fmt.Errorf("cannot read package state: %s", err.Error())
+            }
+            os.Remove(verDir + "/run")
+            return CreateToolWrapper(verDir, artifact, &InstalledArtifact{artifactId, artifactDir, 0})
+          },
+        })
+      }
+    }
+  }
+
+  return problems
+}
+
+/**
+ * Check the packages in the repository
+ */
+func diagnosePackages(baseDir string,
+  references map[string]int,
+  known map[string]*registry.ToolArtifact) []Problem {
+
+  var problems []Problem
+  pkgDir := baseDir + "/pkg"
+
+  _, err := os.Stat(JournalPath(baseDir))
+  hasJournal := err == nil
+
+  pkgs, _ := ioutil.ReadDir(pkgDir)
+  for _, p := range pkgs {
+    artifactId := p.Name()
+    artifactDir := pkgDir + "/" + artifactId
+
+    // Staging directories are only valid while an installation is in progress
+    if strings.HasPrefix(artifactId, ".") {
+      if strings.HasSuffix(artifactId, ".staging") && !hasJournal {
+        problems = append(problems, Problem{
+          ProblemStaleStaging,
+          artifactDir,
+          fmt.Sprintf("%s is left-over from an interrupted installation", artifactDir),
+          func() error {
+            return os.RemoveAll(artifactDir)
+          },
+        })
+      }
+      continue
+    }
+    if !p.IsDir() {
+      continue
+    }
+
+    // The state file must be readable
+    artifact, err := ReadArtifactStateFile(artifactDir + "/.state")
+    if err != nil {
+      problem := Problem{
+        ProblemBrokenState,
+        artifactDir + "/.state",
+        fmt.Sprintf("package %s has an unreadable state: %s", artifactId, err.Error()),
+        nil,
+      }
+      if knownArtifact, ok := known[artifactId]; ok {
+        problem.Fix = func() error {
+          return WriteArtifactStateFile(artifactDir + "/.state", knownArtifact)
+        }
+      } else if references[artifactId] == 0 {
+        problem.Fix = func() error {
+          return os.RemoveAll(artifactDir)
+        }
+      }
+      problems = append(problems, problem)
+      continue
+    }
+
+    // Nothing should be using orphaned packages
+    if references[artifactId] == 0 {
+      problems = append(problems, Problem{
+        ProblemOrphanedPackage,
+        artifactDir,
+        fmt.Sprintf("package %s is not used by any tool", artifactId),
+        func() error {
+          return RemoveGarbagePackage(baseDir, artifactId)
+        },
+      })
+      continue
+    }
+
+    // Check the run-time requirements of the package
+    if artifact.DockerToolArtifact != nil {
+      image := artifact.Image
+      tag := artifact.Tag
+      if !DockerIsAvailable() {
+        problems = append(problems, Problem{
+          ProblemMissingInterpreter,
+          artifactDir,
+          fmt.Sprintf("package %s requires `docker`, which is not available", artifactId),
+          nil,
+        })
+      } else if !DockerHasImage(image, tag) {
+        problems = append(problems, Problem{
+          ProblemMissingImage,
+          artifactDir,
+          fmt.Sprintf("docker image %s:%s is missing", image, tag),
+          func() error {
+            return DockerPullImage(image, tag)
+          },
+        })
+      }
+    }
+    if artifact.ExecutableToolArtifact != nil && artifact.Interpreter != nil {
+      if !InterpreterIsValid(artifact.Interpreter) {
+        problems = append(problems, Problem{
+          ProblemMissingInterpreter,
+          artifactDir,
+          fmt.Sprintf("package %s requires `%s`, which is not available",
+            artifactId, InterpreterName(artifact.Interpreter)),
+          nil,
+        })
+      }
+    }
+  }
+
+  return problems
+}
+
+/**
+ * Check the shims (and links) in the user bin directory that point in the
+ * repository
+ */
+func diagnoseLinks(baseDir string, userBinDir string) []Problem {
+  var problems []Problem
+
+  files, _ := ioutil.ReadDir(userBinDir)
+  for _, f := range files {
+    linkPath := userBinDir + "/" + f.Name()
+    target, ok := ReadBinTarget(linkPath)
+    if !ok || !strings.HasPrefix(target, baseDir + "/") {
+      continue
+    }
+
+    if _, err := os.Stat(target); err != nil {
+      problems = append(problems, Problem{
+        ProblemDanglingLink,
+        linkPath,
+        fmt.Sprintf("%s points to a tool that is no longer installed", linkPath),
+        func() error {
+          return os.Remove(linkPath)
+        },
+      })
+    }
+  }
+
+  return problems
+}
+
+/**
+ * Check that the tools, the packages and the links of the repository agree
+ * with each other. The artifacts known from the registry are used for
+ * repairing broken package states.
+ */
+func Diagnose(baseDir string,
+  userBinDir string,
+  known map[string]*registry.ToolArtifact) ([]Problem, error) {
+
+  if _, err := os.Stat(baseDir); err != nil {
+    return nil, nil
+  }
+
+  lock, err := LockRepository(baseDir, false)
+  if err != nil {
+    return nil, err
+  }
+  defer lock.Unlock()
+
+  return FindProblems(baseDir, userBinDir, known), nil
+}
+
+/**
+ * Collect the problems of the repository. This does not lock the repository,
+ * it's up to the caller to do so.
+ */
+func FindProblems(baseDir string,
+  userBinDir string,
+  known map[string]*registry.ToolArtifact) []Problem {
+
+  // Tools go first, since they collect the package references
+  references := make(map[string]int)
+  problems := diagnoseTools(baseDir, references)
+  problems = append(problems, diagnosePackages(baseDir, references, known)...)
+  problems = append(problems, diagnoseLinks(baseDir, userBinDir)...)
+
+  return problems
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  . "github.com/logrusorgru/aurora"
+  . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
+)
+
+/**
+ * A package that is not used by any tool version
+ */
+type GarbagePackage struct {
+  Artifact    *InstalledArtifact
+  Size        uint64
+
+  // The docker image that can be removed along with the package, or an
+  // empty string if the package has no image, or the image is still in use
+  Image       string
+}
+
+/**
+ * Count the references to every package by scanning the tool versions on disk,
+ * since the in-memory reference counts are not reliable after failed operations
+ */
+func CountAllArtifactReferences(baseDir string) map[string]int {
+  references := make(map[string]int)
+
+  folders, _ := listToolFolders(baseDir)
+  for _, f := range folders {
+    matches, _ := filepath.Glob(f.Folder + "/*")
+    for _, match := range matches {
+      _, artifactId, ok := ParseVersionDirName(filepath.Base(match))
+      if ok {
+        references[artifactId] += 1
+      }
+    }
+  }
+
+  return references
+}
+
+/**
+ * Return the `image:tag` name of the docker image used by a package, or an
+ * empty string if it's not a docker package
+ */
+func packageDockerImage(artifactDir string) string {
+  artifact, err := ReadArtifactStateFile(artifactDir + "/.state")
+  if err != nil || artifact.DockerToolArtifact == nil {
+    return ""
+  }
+  return artifact.Image + ":" + artifact.Tag
+}
+
+/**
+ * Find the packages that are not used by any tool version. This does not lock
+ * the repository, it's up to the caller to do so.
+ */
+func FindGarbage(baseDir string) ([]GarbagePackage, error) {
+  var garbage []GarbagePackage
+  pkgDir := baseDir + "/pkg"
+
+  pkgs, err := ioutil.ReadDir(pkgDir)
+  if err != nil {
+    if os.IsNotExist(err) {
+      return nil, nil
+    }
+    return nil, fmt.Errorf("could not read packages: %s", err.Error())
+  }
+
+  // Split the packages to the ones that are used and the ones that are not,
+  // keeping track of the docker images that are still used
+  references := CountAllArtifactReferences(baseDir)
+  usedImages := make(map[string]bool)
+  for _, p := range pkgs {
+    if !p.IsDir() || strings.HasPrefix(p.Name(), ".") {
+      continue
+    }
+
+    artifactDir := pkgDir + "/" + p.Name()
+    image := packageDockerImage(artifactDir)
+    if references[p.Name()] > 0 {
+      if image != "" {
+        usedImages[image] = true
+      }
+      continue
+    }
+
+    size, err := DirSize(artifactDir)
+    if err != nil {
+      return nil, fmt.Errorf("could not calculate the size of %s: %s", artifactDir, err.Error())
+    }
+
+    garbage = append(garbage, GarbagePackage{
+      &InstalledArtifact{p.Name(), artifactDir, 0},
+      size,
+      image,
+    })
+  }
+
+  // Different packages can share the same docker image (eg. with different
+  // docker arguments), so keep the images that are used by somebody else
+  for idx, _ := range garbage {
+    if usedImages[garbage[idx].Image] {
+      garbage[idx].Image = ""
+    }
+  }
+
+  return garbage, nil
+}
+
+/**
+ * Remove an unused package, running it's uninstall script and removing it's
+ * docker image if nobody else is using it
+ */
+func (pkg *GarbagePackage) Remove() error {
+  fmt.Printf("%s %s %s\n", Bold(Red("==> ")), Bold(Gray("Remove package")), Bold(Red(pkg.Artifact.ID)))
+
+  err := RunUninstallScript(pkg.Artifact.Folder)
+  if err != nil {
+    return err
+  }
+
+  if pkg.Image != "" && DockerIsAvailable() {
+    parts := strings.SplitN(pkg.Image, ":", 2)
+    if DockerHasImage(parts[0], parts[1]) {
+      fmt.Printf("%s %s %s\n", Blue("==> "), Gray("Removing"), Bold(Gray(pkg.Image)))
+      err := DockerRemoveImage(parts[0], parts[1])
+      if err != nil {
+        return err
+      }
+    }
+  }
+
+  return os.RemoveAll(pkg.Artifact.Folder)
+}
+
+/**
+ * Remove all the packages that are not used by any tool version. In dry-run
+ * mode the packages are only collected, without removing anything.
+ */
+func CollectGarbage(baseDir string, dryRun bool) ([]GarbagePackage, error) {
+  if _, err := os.Stat(baseDir); err != nil {
+    return nil, nil
+  }
+
+  lock, err := LockRepository(baseDir, !dryRun)
+  if err != nil {
+    return nil, err
+  }
+  defer lock.Unlock()
+
+  // Don't collect the packages of an interrupted installation
+  if !dryRun {
+    err = RecoverJournal(baseDir)
+    if err != nil {
+      return nil, err
+    }
+  }
+
+  garbage, err := FindGarbage(baseDir)
+  if err != nil || dryRun {
+    return garbage, err
+  }
+
+  for idx, _ := range garbage {
+    err := garbage[idx].Remove()
+    if err != nil {
+      return garbage[:idx], fmt.Errorf("could not remove package %s: %s",
+        garbage[idx].Artifact.ID, err.Error())
+    }
+  }
+
+  return garbage, nil
+}
+
+/**
+ * Remove a single package, if it's still not used by any tool version
+ */
+func RemoveGarbagePackage(baseDir string, artifactId string) error {
+  garbage, err := FindGarbage(baseDir)
+  if err != nil {
+    return err
+  }
+
+  for idx, _ := range garbage {
+    if garbage[idx].Artifact.ID == artifactId {
+      return garbage[idx].Remove()
+    }
+  }
+
+  return nil
+}
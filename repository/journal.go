@@ -0,0 +1,216 @@
+package repository
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "os/signal"
+  "sync/atomic"
+  "syscall"
+  . "github.com/logrusorgru/aurora"
+)
+
+const (
+  JournalStaging    = "staging"
+  JournalCommitted  = "committed"
+)
+
+/**
+ * The on-disk journal of an install transaction. It's kept in the
+ * `.journal` file of the repository for as long as the transaction
+ * is in progress, so an interrupted installation can be rolled back
+ * (or completed) the next time the repository is loaded.
+ */
+type InstallJournal struct {
+  Tool        string      `json:"tool"`
+  Version     string      `json:"version"`
+  Phase       string      `json:"phase"`
+
+  // The paths created by the transaction, in order of creation
+  Created     []string    `json:"created"`
+}
+
+/**
+ * An install transaction in progress
+ */
+type InstallTransaction struct {
+  Journal     InstallJournal
+  path        string
+  signals     chan os.Signal
+  cancel      chan struct{}
+  interrupted int32
+}
+
+/**
+ * Return the path to the journal file in the repository
+ */
+func JournalPath(baseDir string) string {
+  return baseDir + "/.journal"
+}
+
+/**
+ * Start a new install transaction
+ */
+func BeginInstall(baseDir string, tool string, version string) (*InstallTransaction, error) {
+  tx := &InstallTransaction{
+    Journal: InstallJournal{tool, version, JournalStaging, nil},
+    path: JournalPath(baseDir),
+    signals: make(chan os.Signal, 1),
+    cancel: make(chan struct{}),
+  }
+
+  // There can be only one transaction at a time
+  if _, err := os.Stat(tx.path); err == nil {
+    return nil, fmt.Errorf("another installation is in progress")
+  }
+
+  // Make sure the repository exists
+  err := os.MkdirAll(baseDir, 0755)
+  if err != nil {
+    return nil, fmt.Errorf("could not create repository: %s", err.Error())
+  }
+
+  err = tx.save()
+  if err != nil {
+    return nil, err
+  }
+
+  // Keep track of interruptions, so we can roll-back instead of exiting
+  signal.Notify(tx.signals, os.Interrupt, syscall.SIGTERM)
+  go func() {
+    for _ = range tx.signals {
+      if atomic.CompareAndSwapInt32(&tx.interrupted, 0, 1) {
+        close(tx.cancel)
+      }
+    }
+  }()
+
+  return tx, nil
+}
+
+/**
+ * Persist the journal on disk
+ */
+func (tx *InstallTransaction) save() error {
+  byt, err := json.Marshal(tx.Journal)
+  if err != nil {
+    return err
+  }
+
+  // Replace the journal atomically
+  err = ioutil.WriteFile(tx.path + ".tmp", byt, 0644)
+  if err != nil {
+    return fmt.Errorf("could not write journal: %s", err.Error())
+  }
+  err = os.Rename(tx.path + ".tmp", tx.path)
+  if err != nil {
+    return fmt.Errorf("could not write journal: %s", err.Error())
+  }
+
+  return nil
+}
+
+/**
+ * Stop receiving the interruption signals
+ */
+func (tx *InstallTransaction) release() {
+  signal.Stop(tx.signals)
+  close(tx.signals)
+}
+
+/**
+ * Record a path that is going to be created by the transaction. This must be
+ * called before the path is created, so a crash never leaves untracked files.
+ */
+func (tx *InstallTransaction) Track(path string) error {
+  tx.Journal.Created = append(tx.Journal.Created, path)
+  return tx.save()
+}
+
+/**
+ * Return an error if the user has interrupted the transaction
+ */
+func (tx *InstallTransaction) Check() error {
+  if atomic.LoadInt32(&tx.interrupted) != 0 {
+    return fmt.Errorf("installation interrupted")
+  }
+  return nil
+}
+
+/**
+ * Return a channel that is closed when the user interrupts the transaction,
+ * so the long-running operations (eg. downloads) can stop right away
+ */
+func (tx *InstallTransaction) Interrupted() <-chan struct{} {
+  return tx.cancel
+}
+
+/**
+ * Mark the transaction as completed
+ */
+func (tx *InstallTransaction) Commit() error {
+  defer tx.release()
+
+  tx.Journal.Phase = JournalCommitted
+  err := tx.save()
+  if err != nil {
+    return err
+  }
+
+  return os.Remove(tx.path)
+}
+
+/**
+ * Remove everything the transaction has created
+ */
+func (tx *InstallTransaction) Rollback() error {
+  defer tx.release()
+  return rollbackJournal(tx.path, &tx.Journal)
+}
+
+/**
+ * Remove the paths created by the journal, in reverse order, and the journal
+ */
+func rollbackJournal(path string, journal *InstallJournal) error {
+  for idx := len(journal.Created) - 1; idx >= 0; idx-- {
+    err := os.RemoveAll(journal.Created[idx])
+    if err != nil {
+      return fmt.Errorf("could not roll-back %s: %s", journal.Created[idx], err.Error())
+    }
+  }
+
+  return os.Remove(path)
+}
+
+/**
+ * Complete or roll-back a transaction that was interrupted
+ */
+func RecoverJournal(baseDir string) error {
+  path := JournalPath(baseDir)
+  byt, err := ioutil.ReadFile(path)
+  if err != nil {
+    if os.IsNotExist(err) {
+      return nil
+    }
+    return fmt.Errorf("could not read journal: %s", err.Error())
+  }
+
+  // A journal that cannot be parsed was interrupted while it was created
+  // and before any path was tracked in it
+  var journal InstallJournal
+  if err := json.Unmarshal(byt, &journal); err != nil {
+    return os.Remove(path)
+  }
+
+  // If the transaction was committed, only the journal is left
+  if journal.Phase == JournalCommitted {
+    return os.Remove(path)
+  }
+
+  fmt.Printf("%s %s %s\n",
+    Bold(Red("==> ")),
+    Bold(Gray("Rolling back interrupted installation of")),
+    Bold(Red(journal.Tool + "/" + journal.Version)))
+  return rollbackJournal(path, &journal)
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+  "fmt"
+  "os"
+  "syscall"
+  . "github.com/logrusorgru/aurora"
+)
+
+/**
+ * An advisory lock on the repository, shared between all the `ss` processes
+ */
+type RepositoryLock struct {
+  file        *os.File
+}
+
+/**
+ * Return the path to the lock file in the repository
+ */
+func LockPath(baseDir string) string {
+  return baseDir + "/.lock"
+}
+
+/**
+ * Lock the repository. Readers should request a shared lock, while the
+ * operations that modify the repository should request an exclusive one.
+ */
+func LockRepository(baseDir string, exclusive bool) (*RepositoryLock, error) {
+  err := os.MkdirAll(baseDir, 0755)
+  if err != nil {
+    return nil, fmt.Errorf("could not create repository: %s", err.Error())
+  }
+
+  file, err := os.OpenFile(LockPath(baseDir), os.O_RDWR | os.O_CREATE, 0644)
+  if err != nil {
+    return nil, fmt.Errorf("could not open lock file: %s", err.Error())
+  }
+
+  how := syscall.LOCK_SH
+  if exclusive {
+    how = syscall.LOCK_EX
+  }
+
+  // Try to get the lock without blocking, so we can let the user
+  // know why we are waiting if somebody else is holding it
+  err = syscall.Flock(int(file.Fd()), how | syscall.LOCK_NB)
+  if err == syscall.EWOULDBLOCK {
+    fmt.Printf("%s %s\n", Blue("==> "), Gray("Waiting for another ss process to finish..."))
+    err = syscall.Flock(int(file.Fd()), how)
+  }
+  if err != nil {
+    file.Close()
+    return nil, fmt.Errorf("could not lock repository: %s", err.Error())
+  }
+
+  return &RepositoryLock{file}, nil
+}
+
+/**
+ * Release the lock
+ */
+func (lock *RepositoryLock) Unlock() error {
+  defer lock.file.Close()
+  return syscall.Flock(int(lock.file.Fd()), syscall.LOCK_UN)
+}
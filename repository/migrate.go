@@ -0,0 +1,373 @@
+package repository
+
+import (
+  "fmt"
+  "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  . "github.com/logrusorgru/aurora"
+)
+
+/**
+ * Check if there are tool versions in the layout of 0.1.1, or tools that are
+ * not kept in the folder of their registry
+ */
+func (repo *Repository) HasLegacyVersions() bool {
+  for _, tool := range repo.Tools {
+    if len(tool.Legacy) > 0 || tool.Registry == "" {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Remove the files that 0.1.1 created next to the package files, since they
+ * refer to the old location with absolute paths and are re-created in the
+ * new tool version directory
+ */
+func removeLegacyWrappers(artifactDir string, artifact *registry.ToolArtifact) {
+  os.RemoveAll(artifactDir + "/python-venv")
+
+  // The entrypoint defaults to `run`, in which case it's not a wrapper
+  if artifact.ExecutableToolArtifact != nil {
+    if artifact.Entrypoint == "" || artifact.Entrypoint == "run" {
+      return
+    }
+  }
+  os.Remove(artifactDir + "/run")
+}
+
+/**
+ * Point the symlinks of the user bin directory that were pointing to the
+ * legacy version directory to the new location
+ */
+func relinkLegacyVersion(userBinDir string, legacyDir string, execPath string) error {
+  files, _ := ioutil.ReadDir(userBinDir)
+  for _, f := range files {
+    if f.Mode() & os.ModeSymlink == 0 {
+      continue
+    }
+
+    linkPath := userBinDir + "/" + f.Name()
+    target, err := os.Readlink(linkPath)
+    if err != nil {
+      continue
+    }
+    if target != legacyDir && !strings.HasPrefix(target, legacyDir + "/") {
+      continue
+    }
+
+    fmt.Printf("%s %s %s\n", Bold(Blue("==> ")), Bold(Gray("Link")), Bold(Blue(f.Name())))
+    os.Remove(linkPath)
+    err = os.Symlink(execPath, linkPath)
+    if err != nil {
+      return fmt.Errorf("could not re-link %s: %s", linkPath, err.Error())
+    }
+  }
+
+  return nil
+}
+
+/**
+ * Point the links and the shims of the user bin directory that were pointing
+ * inside the old folder to the same place in the new one
+ */
+func relinkMovedFolder(userBinDir string, oldDir string, newDir string) error {
+  files, _ := ioutil.ReadDir(userBinDir)
+  for _, f := range files {
+    binPath := userBinDir + "/" + f.Name()
+    target, ok := ReadBinTarget(binPath)
+    if !ok || !strings.HasPrefix(target, oldDir + "/") {
+      continue
+    }
+    newTarget := newDir + target[len(oldDir):]
+
+    var err error
+    fmt.Printf("%s %s %s\n", Bold(Blue("==> ")), Bold(Gray("Link")), Bold(Blue(f.Name())))
+    if f.Mode() & os.ModeSymlink != 0 {
+      os.Remove(binPath)
+      err = os.Symlink(newTarget, binPath)
+    } else {
+      var byt []byte
+      byt, err = ioutil.ReadFile(binPath)
+      if err == nil {
+        contents := strings.Replace(string(byt), shellQuote(target), shellQuote(newTarget), 1)
+        err = ioutil.WriteFile(binPath, []byte(contents), f.Mode())
+      }
+    }
+    if err != nil {
+      return fmt.Errorf("could not re-link %s: %s", binPath, err.Error())
+    }
+  }
+
+  return nil
+}
+
+/**
+ * Find the registry a tool was installed from, before the tools were kept
+ * per registry. That's the registry with the artifacts of the installed
+ * versions, or else the one the tool name resolves to.
+ */
+func findToolRegistry(tool *InstalledTool, regs *registry.RegistrySet) (string, error) {
+  for _, reg := range regs.Registries {
+    info, ok := reg.Tools[tool.Name]
+    if !ok {
+      continue
+    }
+    for _, ver := range tool.Versions {
+      found := info.Versions.Get(ver.Version)
+      if found == nil {
+        continue
+      }
+      for idx, _ := range found.Artifacts {
+        if ArtifactID(&found.Artifacts[idx]) == ver.Artifact.ID {
+          return reg.Name, nil
+        }
+      }
+    }
+  }
+
+  toolInfo, err := regs.FindTool(tool.Name)
+  if err != nil {
+    return "", err
+  }
+  return toolInfo.Registry, nil
+}
+
+/**
+ * Move a tool that was installed before the tools were kept per registry to
+ * the folder of the registry it was installed from
+ */
+func (repo *Repository) migrateToolRegistry(tool *InstalledTool,
+  regs *registry.RegistrySet,
+  userBinDir string) error {
+
+  registryName, err := findToolRegistry(tool, regs)
+  if err != nil {
+    return fmt.Errorf("could not migrate: %s", err.Error())
+  }
+  registryDir, err := repo.registryFolder(registryName)
+  if err != nil {
+    return err
+  }
+
+  fmt.Printf("%s %s %s\n",
+    Bold(Green("==> ")),
+    Bold(Gray("Migrate")),
+    Bold(Green(ToolKey(registryName, tool.Name))))
+
+  // The same tool might have been installed in the new folder already, in
+  // which case the directories it already has are duplicates
+  toolDir := registryDir + "/" + tool.Name
+  err = os.MkdirAll(toolDir, 0755)
+  if err != nil {
+    return fmt.Errorf("unable to create the tool directory: %s", err.Error())
+  }
+  files, err := ioutil.ReadDir(tool.Folder)
+  if err != nil {
+    return err
+  }
+  for _, f := range files {
+    if _, err := os.Stat(toolDir + "/" + f.Name()); err == nil {
+      continue
+    }
+    err = os.Rename(tool.Folder + "/" + f.Name(), toolDir + "/" + f.Name())
+    if err != nil {
+      return fmt.Errorf("could not move %s: %s", f.Name(), err.Error())
+    }
+  }
+
+  // Keep the links of the user working
+  err = relinkMovedFolder(userBinDir, tool.Folder, toolDir)
+  if err != nil {
+    return err
+  }
+  err = os.RemoveAll(tool.Folder)
+  if err != nil {
+    return err
+  }
+
+  // Keep track of the tool under it's new key
+  delete(repo.Tools, tool.Name)
+  key := ToolKey(registryName, tool.Name)
+  migrated, ok := repo.Tools[key]
+  if !ok {
+    migrated = &InstalledTool{Name: tool.Name, Folder: toolDir, Registry: registryName}
+    repo.Tools[key] = migrated
+  }
+  for _, ver := range tool.Versions {
+    if migrated.FindVersion(ver.Version) == nil {
+      ver.Folder = toolDir + "/" + filepath.Base(ver.Folder)
+      migrated.Versions = append(migrated.Versions, ver)
+    }
+  }
+  for _, legacyDir := range tool.Legacy {
+    migrated.Legacy = append(migrated.Legacy, toolDir + "/" + filepath.Base(legacyDir))
+  }
+
+  return nil
+}
+
+/**
+ * Migrate a single legacy version directory to the current layout
+ */
+func (repo *Repository) migrateLegacyVersion(tool *InstalledTool,
+  legacyDir string,
+  version *registry.ToolVersion,
+  artifact *registry.ToolArtifact,
+  userBinDir string) error {
+
+  artifactId := ArtifactID(artifact)
+  artifactDir := repo.BaseDir + "/pkg/" + artifactId
+  err := os.MkdirAll(repo.BaseDir + "/pkg", 0755)
+  if err != nil {
+    return fmt.Errorf("could not create package directory: %s", err.Error())
+  }
+
+  // Move the files in the package directory, unless another version has
+  // already installed the same package
+  installedArtifact := repo.FindArtifact(artifact)
+  if installedArtifact == nil {
+    installedArtifact = repo.findArtifactOnDisk(artifact)
+  }
+  if installedArtifact == nil {
+    err = os.Rename(legacyDir, artifactDir)
+    if err != nil {
+      return fmt.Errorf("could not move package files: %s", err.Error())
+    }
+    removeLegacyWrappers(artifactDir, artifact)
+
+    installedArtifact = &InstalledArtifact{artifactId, artifactDir, 0}
+    err = installedArtifact.SetRegistryArtifact(artifact)
+    if err != nil {
+      return fmt.Errorf("could not write package state: %s", err.Error())
+    }
+    repo.Sources[artifactId] = installedArtifact
+  }
+
+  // Re-create the tool version with it's wrappers
+  verDir := tool.Folder + "/" + version.Version.ToString() + "-" + artifactId
+  err = os.MkdirAll(verDir, 0755)
+  if err != nil {
+    return fmt.Errorf("unable to create the tool directory: %s", err.Error())
+  }
+  err = CreateToolWrapper(verDir, artifact, installedArtifact)
+  if err != nil {
+    return err
+  }
+  installedArtifact.References += 1
+  repo.addVersion(tool.Registry, tool.Name, tool.Folder, &InstalledVersion{
+    version.Version,
+    installedArtifact,
+    verDir,
+  })
+
+  // Keep the links of the user working
+  err = relinkLegacyVersion(userBinDir, legacyDir, verDir + "/run")
+  if err != nil {
+    return err
+  }
+
+  // The files are duplicate if the package was already there
+  return os.RemoveAll(legacyDir)
+}
+
+/**
+ * Migrate the tool versions installed by 0.1.1, that were keeping the package
+ * files in the tool version directory, to the current layout. The package
+ * state is re-constructed from the registry, so the versions that cannot be
+ * found in the registry are left as-is. The tools that are not kept in the
+ * folder of their registry are moved there, and the registry cache of the
+ * versions without named registries is removed.
+ */
+func (repo *Repository) MigrateLegacyVersions(regs *registry.RegistrySet, userBinDir string) error {
+  err := registry.RemoveCachedRegistry(repo.BaseDir + "/registry.json")
+  if err != nil {
+    return fmt.Errorf("could not remove the old registry cache: %s", err.Error())
+  }
+  if !repo.HasLegacyVersions() {
+    return nil
+  }
+
+  lock, err := LockRepository(repo.BaseDir, true)
+  if err != nil {
+    return err
+  }
+  defer lock.Unlock()
+
+  var unqualified []*InstalledTool = nil
+  for _, tool := range repo.Tools {
+    if tool.Registry == "" {
+      unqualified = append(unqualified, tool)
+    }
+  }
+  for _, tool := range unqualified {
+
+    // Another process might have migrated it while we were waiting
+    if _, err := os.Stat(tool.Folder); err != nil {
+      continue
+    }
+
+    err := repo.migrateToolRegistry(tool, regs, userBinDir)
+    if err != nil {
+      fmt.Printf("%s %s: %s\n", Red("Warning:"), tool.Name, err.Error())
+    }
+  }
+
+  for _, tool := range repo.Tools {
+    var remaining []string
+    for _, legacyDir := range tool.Legacy {
+
+      // Another process might have migrated it while we were waiting
+      if _, err := os.Stat(legacyDir); err != nil {
+        continue
+      }
+
+      verStr := filepath.Base(legacyDir)
+      fmt.Printf("%s %s %s\n",
+        Bold(Green("==> ")),
+        Bold(Gray("Migrate")),
+        Bold(Green(tool.Name + "/" + verStr)))
+
+      err := repo.migrateLegacyFromRegistry(tool, legacyDir, regs, userBinDir)
+      if err != nil {
+        fmt.Printf("%s %s/%s: %s (remove %s if you don't need it)\n",
+          Red("Warning:"), tool.Name, verStr, err.Error(), legacyDir)
+        remaining = append(remaining, legacyDir)
+      }
+    }
+    tool.Legacy = remaining
+  }
+
+  return nil
+}
+
+/**
+ * Find the artifact of a legacy version in the registry and migrate it
+ */
+func (repo *Repository) migrateLegacyFromRegistry(tool *InstalledTool,
+  legacyDir string,
+  regs *registry.RegistrySet,
+  userBinDir string) error {
+
+  toolInfo, err := regs.FindTool(ToolKey(tool.Registry, tool.Name))
+  if err != nil {
+    return fmt.Errorf("could not migrate: %s", err.Error())
+  }
+  version, err := toolInfo.Versions.Find(filepath.Base(legacyDir))
+  if err != nil {
+    return fmt.Errorf("could not migrate: %s", err.Error())
+  }
+
+  // The files were installed from the artifact that was runnable back then,
+  // which is most probably the one that is runnable now
+  artifact, _ := FindFirstRunableArtifact(version.Artifacts)
+  if artifact == nil {
+    return fmt.Errorf("could not migrate: no installable artifacts found")
+  }
+
+  return repo.migrateLegacyVersion(tool, legacyDir, version, artifact, userBinDir)
+}
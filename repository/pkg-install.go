@@ -1,6 +1,7 @@
 package repository
 
 import (
+  "context"
   "fmt"
   "github.com/mesosphere/dcos-sonic-screwdriver/registry"
   "gopkg.in/src-d/go-git.v4"
@@ -35,56 +36,74 @@ func RunInstallScript(pkgDir string, artifact *registry.ToolArtifact) error {
   return nil
 }
 
+/**
+ * Download the contents of the artifact in the given directory. The download
+ * is aborted when the `cancel` channel is closed.
+ */
+func DownloadArtifact(dstDir string, artifact *registry.ToolArtifact, cancel <-chan struct{}) error {
+  if (artifact.DockerToolArtifact != nil) {
+    return InstallDockerArtifact(dstDir, artifact)
+  } else if (artifact.ExecutableToolArtifact != nil) {
+    if artifact.Source.WebArchiveTarSource != nil {
+      return InstallWebArchiveTarSource(dstDir, artifact, cancel)
+    } else if artifact.Source.WebFileSource != nil {
+      return InstallWebFileSource(dstDir, artifact, cancel)
+    } else if artifact.Source.VCSGitSource != nil {
+      return InstallVcsGitSource(dstDir, artifact, cancel)
+    } else {
+      return fmt.Errorf("unknown web artifact source type")
+    }
+  }
+
+  return fmt.Errorf("unknown artifact type")
+}
+
 /**
  * Download and install the source package from the given artifact
+ *
+ * The package is downloaded in a staging directory next to it's final location
+ * and it's moved into place once the download is complete. The install script
+ * runs in the final location, since the scripts often record absolute paths
+ * (eg. in virtual environments). The package is complete only when it has a
+ * state file, which is written last.
  */
-func InstallArtifact(pkgDir string, toolDir string, artifact *registry.ToolArtifact) (*InstalledArtifact, error) {
-  // If target directory already exists, wipe it and re-create it
-  // NOTE: If this function is called, it means that the directory is NOT known
-  //       to the system and therefore it should be considered wrong.
+func InstallArtifact(tx *InstallTransaction, pkgDir string, toolDir string, artifact *registry.ToolArtifact) (*InstalledArtifact, error) {
   artifactId := ArtifactID(artifact)
   dstDir := pkgDir + "/" + artifactId
-  if _, err := os.Stat(dstDir); err == nil {
-    os.RemoveAll(dstDir)
+  stageDir := pkgDir + "/." + artifactId + ".staging"
+
+  // Prepare a clean staging directory
+  err := tx.Track(stageDir)
+  if err != nil {
+    return nil, err
   }
-  err := os.MkdirAll(dstDir, 0755)
+  os.RemoveAll(stageDir)
+  err = os.MkdirAll(stageDir, 0755)
   if err != nil {
     return nil, fmt.Errorf("could not create package dir: %s", err.Error())
   }
 
   // Download artifact contents
-  if (artifact.DockerToolArtifact != nil) {
-    err := InstallDockerArtifact(dstDir, artifact)
-    if err != nil {
-      os.RemoveAll(dstDir)
-      return nil, err
-    }
-  } else if (artifact.ExecutableToolArtifact != nil) {
-    if artifact.Source.WebArchiveTarSource != nil {
-      err := InstallWebArchiveTarSource(dstDir, artifact)
-      if err != nil {
-        os.RemoveAll(dstDir)
-        return nil, err
-      }
-    } else if artifact.Source.WebFileSource != nil {
-      err := InstallWebFileSource(dstDir, artifact)
-      if err != nil {
-        os.RemoveAll(dstDir)
-        return nil, err
-      }
-    } else if artifact.Source.VCSGitSource != nil {
-      err := InstallVcsGitSource(dstDir, artifact)
-      if err != nil {
-        os.RemoveAll(dstDir)
-        return nil, err
-      }
-    } else {
-      os.RemoveAll(dstDir)
-      return nil, fmt.Errorf("unknown web artifact source type")
-    }
-  } else {
+  err = DownloadArtifact(stageDir, artifact, tx.Interrupted())
+  if err != nil {
+    return nil, err
+  }
+  if err = tx.Check(); err != nil {
+    return nil, err
+  }
+
+  // Move the package into place. If the target directory already exists,
+  // it's not known to the system and therefore it should be considered wrong.
+  err = tx.Track(dstDir)
+  if err != nil {
+    return nil, err
+  }
+  if _, err := os.Stat(dstDir); err == nil {
     os.RemoveAll(dstDir)
-    return nil, fmt.Errorf("unknown artifact type")
+  }
+  err = os.Rename(stageDir, dstDir)
+  if err != nil {
+    return nil, fmt.Errorf("could not move package into place: %s", err.Error())
   }
 
   // If there is an install script, run it now
@@ -92,6 +111,9 @@ func InstallArtifact(pkgDir string, toolDir string, artifact *registry.ToolArtif
   if err != nil {
     return nil, err
   }
+  if err = tx.Check(); err != nil {
+    return nil, err
+  }
 
   // If there is an uninstall script, create an uninstall wrapper now
   err = CreateUninstallScript(dstDir, artifact)
@@ -101,15 +123,17 @@ func InstallArtifact(pkgDir string, toolDir string, artifact *registry.ToolArtif
 
   // If we reached this point, the operation was successful, so
   // dump the artifact state in the directory
-  instArtifact := &InstalledArtifact{
-    artifactId,
-    dstDir,
-    0,
+  err = WriteArtifactStateFile(dstDir + "/.state", artifact)
+  if err != nil {
+    return nil, fmt.Errorf("could not write package state: %s", err.Error())
   }
-  instArtifact.SetRegistryArtifact(artifact)
 
   // Return the installed artifact
-  return instArtifact, nil
+  return &InstalledArtifact{
+    artifactId,
+    dstDir,
+    0,
+  }, nil
 }
 
 /**
@@ -123,9 +147,10 @@ func InstallDockerArtifact(dstDir string, artifact *registry.ToolArtifact) error
 /**
  * Download & Install a Tar Archive
  */
-func InstallWebFileSource(dstDir string, artifact *registry.ToolArtifact) error {
+func InstallWebFileSource(dstDir string, artifact *registry.ToolArtifact, cancel <-chan struct{}) error {
   fmt.Printf("%s %s %s\n", Blue("==> "), Gray("Downloading"), Bold(Gray(artifact.Source.FileURL)))
   return Download(artifact.Source.FileURL, WithoutCompression).
+         AndCancelOn(cancel).
          AndShowProgress("").
          AndValidateChecksum(artifact.Source.FileChecksum).
          AndDecompressIfCompressed().
@@ -135,9 +160,10 @@ func InstallWebFileSource(dstDir string, artifact *registry.ToolArtifact) error
 /**
  * Download & Install a Tar Archive
  */
-func InstallWebArchiveTarSource(dstDir string, artifact *registry.ToolArtifact) error {
+func InstallWebArchiveTarSource(dstDir string, artifact *registry.ToolArtifact, cancel <-chan struct{}) error {
   fmt.Printf("%s %s %s\n", Blue("==> "), Gray("Downloading"), Bold(Gray(artifact.Source.TarURL)))
   return Download(artifact.Source.TarURL, WithoutCompression).
+         AndCancelOn(cancel).
          AndShowProgress("").
          AndValidateChecksum(artifact.Source.TarChecksum).
          AndDecompressIfCompressed().
@@ -147,7 +173,7 @@ func InstallWebArchiveTarSource(dstDir string, artifact *registry.ToolArtifact)
 /**
  * Download & Install a Git repository
  */
-func InstallVcsGitSource(pkgDir string, artifact *registry.ToolArtifact) error {
+func InstallVcsGitSource(pkgDir string, artifact *registry.ToolArtifact, cancel <-chan struct{}) error {
   fmt.Printf("%s %s %s\n", Blue("==> "), Gray("Cloning"), Bold(Gray(artifact.Source.GitURL)))
 
   // Find the branch to fetch
@@ -156,8 +182,20 @@ func InstallVcsGitSource(pkgDir string, artifact *registry.ToolArtifact) error {
     remoteBranch = "refs/heads/master"
   }
 
-  // Clone the repository
-  _, err := git.PlainClone(pkgDir, false, &git.CloneOptions{
+  // Clone the repository, stopping if the user interrupts us
+  if err := CheckOnline(artifact.Source.GitURL); err != nil {
+    return err
+  }
+  ctx, stop := context.WithCancel(context.Background())
+  defer stop()
+  go func() {
+    select {
+      case <-cancel:
+        stop()
+      case <-ctx.Done():
+    }
+  }()
+  _, err := git.PlainCloneContext(ctx, pkgDir, false, &git.CloneOptions{
       URL:            artifact.Source.GitURL,
       SingleBranch:   true,
       ReferenceName:  plumbing.ReferenceName(remoteBranch),
@@ -173,43 +211,39 @@ func InstallVcsGitSource(pkgDir string, artifact *registry.ToolArtifact) error {
 
 /**
  * Install a specific tool version
+ *
+ * NOTE: The wrappers (and interpreter sandboxes) refer to their location with
+ *       absolute paths, so they are created in-place. The transaction takes
+ *       care of removing them if something goes wrong.
  */
-func InstallToolVersion(toolDir string,
+func InstallToolVersion(tx *InstallTransaction,
+  toolDir string,
   version *registry.ToolVersion,
   artifact *registry.ToolArtifact,
   installedArtifact *InstalledArtifact) (*InstalledVersion, error) {
 
   // Prepare tool directories
+  if _, err := os.Stat(toolDir); err != nil {
+    if err := tx.Track(toolDir); err != nil {
+      return nil, err
+    }
+  }
   toolVerDir := toolDir + "/" + version.Version.ToString() + "-" + installedArtifact.ID
+  if err := tx.Track(toolVerDir); err != nil {
+    return nil, err
+  }
   err := os.MkdirAll(toolVerDir, 0755)
   if err != nil {
     return nil, fmt.Errorf("unable to create the tool directory: %s", err.Error())
   }
 
   // Create wrappers
-  if (artifact.DockerToolArtifact != nil) {
-    err := CreateDockerWrapper(toolVerDir, artifact, installedArtifact)
-    if err != nil {
-      os.RemoveAll(toolVerDir)
-      return nil, err
-    }
-  } else if (artifact.ExecutableToolArtifact != nil) {
-    if artifact.Interpreter != nil {
-      err := CreateInterpreterWrapper(toolVerDir, artifact, installedArtifact)
-      if err != nil {
-        os.RemoveAll(toolVerDir)
-        return nil, err
-      }
-    } else {
-      err := CreateBinaryWrapper(toolVerDir, artifact, installedArtifact)
-      if err != nil {
-        os.RemoveAll(toolVerDir)
-        return nil, err
-      }
-    }
-  } else {
-    os.RemoveAll(toolVerDir)
-    return nil, fmt.Errorf("unknown artifact type")
+  err = CreateToolWrapper(toolVerDir, artifact, installedArtifact)
+  if err != nil {
+    return nil, err
+  }
+  if err = tx.Check(); err != nil {
+    return nil, err
   }
 
   // increment artifact references
@@ -222,6 +256,26 @@ func InstallToolVersion(toolDir string,
   }, nil
 }
 
+/**
+ * Create the `run` wrapper of a tool version, according to the artifact type
+ */
+func CreateToolWrapper(toolVerDir string,
+  artifact *registry.ToolArtifact,
+  installedArtifact *InstalledArtifact) error {
+
+  if (artifact.DockerToolArtifact != nil) {
+    return CreateDockerWrapper(toolVerDir, artifact, installedArtifact)
+  } else if (artifact.ExecutableToolArtifact != nil) {
+    if artifact.Interpreter != nil {
+      return CreateInterpreterWrapper(toolVerDir, artifact, installedArtifact)
+    } else {
+      return CreateBinaryWrapper(toolVerDir, artifact, installedArtifact)
+    }
+  }
+
+  return fmt.Errorf("unknown artifact type")
+}
+
 /**
  * Create a docker wrapper script
  */
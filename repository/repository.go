@@ -2,6 +2,8 @@ package repository
 
 import (
   "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  "crypto/sha256"
+  "encoding/hex"
   "io/ioutil"
   "path/filepath"
   "path"
@@ -12,6 +14,35 @@ import (
   . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
 )
 
+/**
+ * The file that marks a folder in `tools` as the folder of a registry. It
+ * contains the name of the registry the tools in it were installed from.
+ */
+const RegistryMarker = ".registry"
+
+/**
+ * A tool folder in the repository, along with the registry it belongs to
+ */
+type toolFolder struct {
+  Registry    string
+  Folder      string
+}
+
+/**
+ * Split a `<version>-<artifact ID>` directory name to it's components. The
+ * artifact ID must be a SHA256 checksum, so the pre-release versions of the
+ * legacy layout (eg. `1.0.0-beta`) are not mistaken for an artifact.
+ */
+func ParseVersionDirName(name string) (string, string, bool) {
+  idx := strings.LastIndex(name, "-")
+  if idx <= 0 || len(name) - idx - 1 != sha256.Size * 2 {
+    return "", "", false
+  }
+  if _, err := hex.DecodeString(name[idx+1:]); err != nil {
+    return "", "", false
+  }
+  return name[:idx], name[idx+1:], true
+}
 
 /**
  * Load a tool description based on what we will find in the `toolDir`
@@ -31,25 +62,25 @@ func LoadRepositoryTool(toolDir string,
   for _, f := range files {
 
     // Extract version/source pair
-    parts := strings.Split(f.Name(), "-")
-    if len(parts) == 1 {
+    verStr, sourceId, ok := ParseVersionDirName(f.Name())
+    if !ok {
 
-      // TODO: Version 0.1.1 of the tool was not separating sources from tools.
-      // Therefore we have to create a virtual source in the same directory
-      // with the tool.
+      // Version 0.1.1 of the tool was not separating sources from tools.
+      // Keep track of these directories, so they can be migrated once the
+      // registry is available.
+      tool.Legacy = append(tool.Legacy, toolDir + "/" + f.Name())
 
-    } else if (len(parts) == 2) {
+    } else {
 
       // Parse version
       versionDir := toolDir + "/" + f.Name()
-      version, err := VersionFromString(parts[0])
+      version, err := ParseSemVer(verStr)
       if err != nil {
         return tool, fmt.Errorf("Could not parse tool '%s' version '%s': %s",
           filepath.Base(toolDir), f.Name(), err.Error())
       }
 
       // Get source folder
-      sourceId := parts[1]
       sourceDir := pkgDir + "/" + sourceId
       if _, err := os.Stat(sourceDir); err != nil {
         return tool, fmt.Errorf("Source package '%s' was not found", sourceDir)
@@ -75,6 +106,70 @@ func LoadRepositoryTool(toolDir string,
   return tool, nil
 }
 
+/**
+ * List the tool folders in the repository. The tools are kept in a folder
+ * per registry (`tools/<registry>/<tool>`), while the tools installed before
+ * that (`tools/<tool>`) are returned without a registry.
+ */
+func listToolFolders(baseDir string) ([]toolFolder, error) {
+  var folders []toolFolder
+  toolsDir := baseDir + "/tools"
+
+  files, err := ioutil.ReadDir(toolsDir)
+  if err != nil {
+    if os.IsNotExist(err) {
+      return nil, nil
+    }
+    return nil, err
+  }
+  for _, f := range files {
+    if !f.IsDir() {
+      continue
+    }
+
+    dir := toolsDir + "/" + f.Name()
+    byt, err := ioutil.ReadFile(dir + "/" + RegistryMarker)
+    if err != nil {
+      folders = append(folders, toolFolder{"", dir})
+      continue
+    }
+
+    registryName := strings.TrimSpace(string(byt))
+    tools, err := ioutil.ReadDir(dir)
+    if err != nil {
+      return nil, err
+    }
+    for _, t := range tools {
+      if t.IsDir() {
+        folders = append(folders, toolFolder{registryName, dir + "/" + t.Name()})
+      }
+    }
+  }
+
+  return folders, nil
+}
+
+/**
+ * Return the folder the tools of the registry are installed in, creating it
+ * (along with it's marker) if it's missing
+ */
+func (repo *Repository) registryFolder(registryName string) (string, error) {
+  dir := repo.BaseDir + "/tools/" + registryName
+  if _, err := os.Stat(dir + "/" + RegistryMarker); err == nil {
+    return dir, nil
+  }
+
+  err := os.MkdirAll(dir, 0755)
+  if err != nil {
+    return "", fmt.Errorf("unable to create the registry directory: %s", err.Error())
+  }
+  err = ioutil.WriteFile(dir + "/" + RegistryMarker, []byte(registryName + "\n"), 0644)
+  if err != nil {
+    return "", fmt.Errorf("unable to create the registry directory: %s", err.Error())
+  }
+  return dir, nil
+}
+
 /**
  * Reads the repository directory and populates the repository structure
  */
@@ -89,52 +184,119 @@ func LoadRepository(baseDir string) (*Repository, error) {
     return repository, nil
   }
 
-  // Compute the directory names
-  toolDir := baseDir + "/tools"
-  pkgDir := baseDir + "/pkg"
+  // Complete or roll-back any interrupted installation. If the installation
+  // is still in progress, this waits until it's completed.
+  if _, err := os.Stat(JournalPath(baseDir)); err == nil {
+    lock, err := LockRepository(baseDir, true)
+    if err != nil {
+      return nil, err
+    }
+    err = RecoverJournal(baseDir)
+    lock.Unlock()
+    if err != nil {
+      return nil, err
+    }
+  }
 
-  // Skip missing dirs
-  if _, err := os.Stat(toolDir); err != nil {
-    return repository, nil
+  // Make sure nobody is modifying the repository while we are reading it
+  lock, err := LockRepository(baseDir, false)
+  if err != nil {
+    return nil, err
   }
-  if _, err := os.Stat(pkgDir); err != nil {
+  defer lock.Unlock()
+
+  return repository, repository.readTools()
+}
+
+/**
+ * Read the repository without locking it, and without recovering any
+ * interrupted installation. This is used by the shims, that are running
+ * in place of the tools, so they must neither wait nor print anything.
+ * The versions of an installation in progress might be missing.
+ */
+func ReadRepository(baseDir string) (*Repository, error) {
+  repository := new(Repository)
+  repository.BaseDir = baseDir
+  repository.Tools = make(map[string]*InstalledTool)
+  repository.Sources = make(map[string]*InstalledArtifact)
+
+  if _, err := os.Stat(baseDir); err != nil {
     return repository, nil
   }
+  return repository, repository.readTools()
+}
 
-  // List versions
-  files, err := ioutil.ReadDir(toolDir)
+/**
+ * Populate the tools and the sources of the repository from the disk
+ */
+func (repo *Repository) readTools() error {
+
+  // List versions (the repositories of 0.1.1 have no packages)
+  pkgDir := repo.BaseDir + "/pkg"
+  folders, err := listToolFolders(repo.BaseDir)
   if err != nil {
-    return repository, err
+    return err
   }
-  for _, f := range files {
-    tool, err := LoadRepositoryTool(toolDir + "/" + f.Name(), pkgDir, &repository.Sources)
+  for _, f := range folders {
+    tool, err := LoadRepositoryTool(f.Folder, pkgDir, &repo.Sources)
     if err != nil {
-      return nil, err
+      return err
     }
 
-    repository.Tools[f.Name()] = tool
+    tool.Registry = f.Registry
+    repo.Tools[ToolKey(f.Registry, tool.Name)] = tool
   }
 
-  return repository, nil
+  return nil
 }
 
 /**
  * Find the version of the specified tool
  */
-func (repo *Repository) FindToolVersion(tool string,
-  version VersionTriplet) *InstalledVersion {
+func (repo *Repository) FindToolVersion(registryName string,
+  tool string,
+  version SemVer) *InstalledVersion {
 
-  if tool, ok := repo.Tools[tool]; ok {
+  if tool, ok := repo.Tools[ToolKey(registryName, tool)]; ok {
     return tool.FindVersion(version)
   }
 
   return nil
 }
 
+/**
+ * Find an installed tool by it's name, optionally qualified with the registry
+ * it was installed from (`registry/tool`). Unqualified names must match the
+ * tool of a single registry.
+ */
+func (repo *Repository) FindInstalledTool(name string) (*InstalledTool, error) {
+  if toolRef, ok := repo.Tools[name]; ok {
+    return toolRef, nil
+  }
+  registryName, tool := registry.SplitToolName(name)
+  if registryName != "" {
+    return nil, nil
+  }
+
+  var found *InstalledTool = nil
+  for _, toolRef := range repo.Tools {
+    if toolRef.Name != tool {
+      continue
+    }
+    if found != nil {
+      return nil, fmt.Errorf("'%s' is installed from more than one registry, use `<registry>/%s` to choose one",
+        tool, tool)
+    }
+    found = toolRef
+  }
+
+  return found, nil
+}
+
 /**
  * Scan the list of versions and find the given version
  */
-func (tool *InstalledTool) FindVersion(version VersionTriplet) *InstalledVersion {
+func (tool *InstalledTool) FindVersion(version SemVer) *InstalledVersion {
   for _, ver := range tool.Versions {
     if ver.Version.Equals(version) {
       return &ver
@@ -143,6 +305,26 @@ func (tool *InstalledTool) FindVersion(version VersionTriplet) *InstalledVersion
   return nil
 }
 
+/**
+ * Find the latest installed version that satisfies the given version
+ * constraint (eg. `1.2` matches `1.2.0` and `1.2.3`)
+ */
+func (tool *InstalledTool) FindMatchingVersion(version string) (*InstalledVersion, error) {
+  var found *InstalledVersion = nil
+
+  constraint, err := ParseVersionConstraint(version)
+  if err != nil {
+    return nil, err
+  }
+  for idx, ver := range tool.Versions {
+    if constraint.Check(ver.Version) && (found == nil || ver.Version.GreaterThan(&found.Version)) {
+      found = &tool.Versions[idx]
+    }
+  }
+
+  return found, nil
+}
+
 /**
  * Find the installed version by matching the link of every tool in the registry
  */
@@ -171,6 +353,43 @@ func (repo *Repository) FindArtifact(artifact *registry.ToolArtifact) *Installed
   return nil
 }
 
+/**
+ * Find an artifact that was installed on disk after the repository was loaded
+ * (eg. by another process)
+ */
+func (repo *Repository) findArtifactOnDisk(artifact *registry.ToolArtifact) *InstalledArtifact {
+  aid := ArtifactID(artifact)
+  pkgDir := repo.BaseDir + "/pkg/" + aid
+  if _, err := os.Stat(pkgDir + "/.state"); err != nil {
+    return nil
+  }
+
+  refs, _ := CountArtifactReferences(repo.BaseDir, aid)
+  installedArtifact := &InstalledArtifact{aid, pkgDir, refs}
+  repo.Sources[aid] = installedArtifact
+  return installedArtifact
+}
+
+/**
+ * Count the tool versions on disk that are using the given artifact
+ */
+func CountArtifactReferences(baseDir string, artifactId string) (int, error) {
+  folders, err := listToolFolders(baseDir)
+  if err != nil {
+    return 0, err
+  }
+
+  count := 0
+  for _, f := range folders {
+    matches, err := filepath.Glob(f.Folder + "/*-" + artifactId)
+    if err != nil {
+      return 0, err
+    }
+    count += len(matches)
+  }
+  return count, nil
+}
+
 /**
  * Remove a version from the tool list
  */
@@ -194,8 +413,8 @@ func (ver *InstalledVersion) GetExecutablePath() string {
 /**
  * Check if the tool exists in the repository
  */
-func (repo *Repository) IsToolInstalled(tool string) bool {
-  if _, ok := repo.Tools[tool]; ok {
+func (repo *Repository) IsToolInstalled(registryName string, tool string) bool {
+  if _, ok := repo.Tools[ToolKey(registryName, tool)]; ok {
     return true
   }
   return false
@@ -211,8 +430,8 @@ func (repo *InstalledTool) HasInstalledVersions() bool {
 /**
  * Check if a specific tool version exists
  */
-func (repo *Repository) IsToolVersionInstalled(tool string, version *VersionTriplet) bool {
-  if toolRef, ok := repo.Tools[tool]; ok {
+func (repo *Repository) IsToolVersionInstalled(registryName string, tool string, version *SemVer) bool {
+  if toolRef, ok := repo.Tools[ToolKey(registryName, tool)]; ok {
     for _, x := range toolRef.Versions {
       if x.Version.Equals(*version) {
         return true
@@ -225,12 +444,13 @@ func (repo *Repository) IsToolVersionInstalled(tool string, version *VersionTrip
 /**
  * Install the specified tool in the repository
  */
-func (repo *Repository) InstallToolVersion(tool string,
+func (repo *Repository) InstallToolVersion(registryName string,
+  tool string,
   version *registry.ToolVersion,
   artifact *registry.ToolArtifact) (*InstalledVersion, error) {
   var err error
 
-  toolDir := repo.BaseDir + "/tools/" + SanitizedToolName(tool)
+  toolDir := repo.BaseDir + "/tools/" + registryName + "/" + SanitizedToolName(tool)
   pkgBaseDir := repo.BaseDir + "/pkg"
 
   fmt.Printf("%s %s %s\n",
@@ -238,45 +458,109 @@ func (repo *Repository) InstallToolVersion(tool string,
     Bold(Gray("Add")),
     Bold(Green(tool + "/" + version.Version.ToString())))
 
-  // Find or install the related tool artifact
+  // Make sure we are the only ones modifying the repository
+  lock, err := LockRepository(repo.BaseDir, true)
+  if err != nil {
+    return nil, err
+  }
+  defer lock.Unlock()
+  if err := RecoverJournal(repo.BaseDir); err != nil {
+    return nil, err
+  }
+  if _, err := repo.registryFolder(registryName); err != nil {
+    return nil, err
+  }
+
+  // Find the related tool artifact, including the ones that might have been
+  // installed by another process while we were waiting for the lock
   installedArtifact := repo.FindArtifact(artifact)
   if installedArtifact == nil {
+    installedArtifact = repo.findArtifactOnDisk(artifact)
+  }
+  newArtifact := installedArtifact == nil
+
+  // The same goes for the tool version itself
+  if !newArtifact {
+    verDir := toolDir + "/" + version.Version.ToString() + "-" + installedArtifact.ID
+    if _, err := os.Stat(verDir + "/run"); err == nil {
+      installedVersion := &InstalledVersion{version.Version, installedArtifact, verDir}
+      repo.addVersion(registryName, tool, toolDir, installedVersion)
+      return installedVersion, nil
+    }
+  }
+
+  // Everything created from now on is rolled back if we fail
+  tx, err := BeginInstall(repo.BaseDir, ToolKey(registryName, tool), version.Version.ToString())
+  if err != nil {
+    return nil, err
+  }
+
+  // Install the related tool artifact if missing
+  if newArtifact {
     installedArtifact, err = InstallArtifact(
+      tx,
       pkgBaseDir,
       toolDir,
       artifact,
     )
     if err != nil {
+      tx.Rollback()
       return nil, err
     }
-
-    // Keep track of the installed artifact
-    repo.Sources[ArtifactID(artifact)] = installedArtifact
   }
 
   // Install the tool
   installedVersion, err := InstallToolVersion(
+    tx,
     toolDir,
     version,
     artifact,
     installedArtifact,
   )
   if err != nil {
+    tx.Rollback()
     return nil, err
   }
 
+  // Complete the transaction
+  err = tx.Commit()
+  if err != nil {
+    return nil, err
+  }
+
+  // Keep track of the installed artifact
+  if newArtifact {
+    repo.Sources[ArtifactID(artifact)] = installedArtifact
+  }
+
   // Put the version in the registry
-  if toolRef, ok := repo.Tools[tool]; ok {
-    toolRef.Versions = append(toolRef.Versions, *installedVersion)
+  repo.addVersion(registryName, tool, toolDir, installedVersion)
+
+  // Return the new pointers
+  return installedVersion, nil
+}
+
+/**
+ * Keep track of a newly installed version
+ */
+func (repo *Repository) addVersion(registryName string,
+  tool string,
+  toolDir string,
+  installedVersion *InstalledVersion) {
+
+  key := ToolKey(registryName, tool)
+  if toolRef, ok := repo.Tools[key]; ok {
+    if toolRef.FindVersion(installedVersion.Version) == nil {
+      toolRef.Versions = append(toolRef.Versions, *installedVersion)
+    }
   } else {
     toolRef := new(InstalledTool)
     toolRef.Folder = toolDir
     toolRef.Versions = append(toolRef.Versions, *installedVersion)
     toolRef.Name = tool
+    toolRef.Registry = registryName
+    repo.Tools[key] = toolRef
   }
-
-  // Return the new pointers
-  return installedVersion, nil
 }
 
 /**
@@ -289,9 +573,29 @@ func (repo *Repository) UninstallToolVersion(tool *InstalledTool, version *Insta
     Bold(Gray("Remove")),
     Bold(Red(tool.Name + "/" + version.Version.ToString())))
 
-  // Decrement usages of the artifact and clean-up if we are not using it anywhere else
+  // Make sure we are the only ones modifying the repository
+  lock, err := LockRepository(repo.BaseDir, true)
+  if err != nil {
+    return err
+  }
+  defer lock.Unlock()
+
+  // Uninstall the tool
+  err = UninstallToolVersion(version)
+  if err != nil {
+    return err
+  }
+
+  // Remove version from the tool
+  tool.RemoveVersion(version)
+
+  // Count the usages of the artifact on disk, since another process might
+  // have started using it, and clean-up if it's not used anywhere else
   artifact := version.Artifact
-  artifact.References -= 1
+  artifact.References, err = CountArtifactReferences(repo.BaseDir, artifact.ID)
+  if err != nil {
+    return err
+  }
   if (artifact.References == 0) {
 
     // Uninstall the artifact
@@ -304,14 +608,6 @@ func (repo *Repository) UninstallToolVersion(tool *InstalledTool, version *Insta
     delete(repo.Sources, artifact.ID)
   }
 
-  // Uninstall the tool
-  err := UninstallToolVersion(version)
-  if err != nil {
-    return err
-  }
-
-  // Remove version from the tool
-  tool.RemoveVersion(version)
   return nil
 }
 
@@ -319,13 +615,19 @@ func (repo *Repository) UninstallToolVersion(tool *InstalledTool, version *Insta
  * Install the specified tool from the repository
  */
 func (repo *Repository) UninstallTool(tool *InstalledTool) error {
-  err := UninstallTool(tool)
+  lock, err := LockRepository(repo.BaseDir, true)
+  if err != nil {
+    return err
+  }
+  defer lock.Unlock()
+
+  err = UninstallTool(tool)
   if err != nil {
     return err
   }
 
   // Remove the tool from the repository
-  delete(repo.Tools, tool.Name)
+  delete(repo.Tools, ToolKey(tool.Registry, tool.Name))
   return nil
 }
 
@@ -0,0 +1,92 @@
+package repository
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "strings"
+)
+
+/**
+ * The line that marks a shim as created by us
+ */
+const ShimMarker = "# Created by sonic-screwdriver, do not edit"
+
+/**
+ * Quote a string for use in a shell script
+ */
+func shellQuote(s string) string {
+  return "'" + strings.Replace(s, "'", "'\\''", -1) + "'"
+}
+
+/**
+ * Return the contents of a shim script that calls `ss shim` in order to pick
+ * the tool version required by the project manifest. The `target` is the
+ * executable to use when there is no project manifest.
+ */
+func ShimContents(ssPath string, tool string, target string) []byte {
+  return []byte(fmt.Sprintf(
+    "#!/bin/sh\n%s\ntarget=%s\nexec %s shim %s \"$target\" \"$@\"\n",
+    ShimMarker,
+    shellQuote(target),
+    shellQuote(ssPath),
+    shellQuote(tool)))
+}
+
+/**
+ * How much of a file is read when looking for the header of a shim, which is
+ * the shebang, the marker and the target lines. This fits the longest paths
+ * (`PATH_MAX`) along with the rest of the header.
+ */
+const shimHeaderSize = 8192
+
+/**
+ * Read the default target of a shim script. The second value is `false` if
+ * the file is not a shim created by us, or if it cannot be read.
+ */
+func ReadShimTarget(path string) (string, bool) {
+  file, err := os.Open(path)
+  if err != nil {
+    return "", false
+  }
+  defer file.Close()
+
+  // Only the header is read, since the file can be anything (eg. a binary)
+  header := make([]byte, shimHeaderSize)
+  n, err := io.ReadFull(file, header)
+  if err != nil && err != io.ErrUnexpectedEOF {
+    return "", false
+  }
+
+  lines := strings.Split(string(header[:n]), "\n")
+  if len(lines) < 3 || lines[1] != ShimMarker {
+    return "", false
+  }
+  line := lines[2]
+  if strings.HasPrefix(line, "target='") && strings.HasSuffix(line, "'") {
+    target := line[len("target='") : len(line) - 1]
+    return strings.Replace(target, "'\\''", "'", -1), true
+  }
+
+  return "", false
+}
+
+/**
+ * Return the target of a shim, or of a symbolic link created by the previous
+ * versions. The second value is `false` if the file is neither of them, or
+ * if it cannot be read.
+ */
+func ReadBinTarget(path string) (string, bool) {
+  info, err := os.Lstat(path)
+  if err != nil {
+    return "", false
+  }
+  if info.Mode() & os.ModeSymlink != 0 {
+    target, err := os.Readlink(path)
+    return target, err == nil
+  }
+  if !info.Mode().IsRegular() {
+    return "", false
+  }
+  return ReadShimTarget(path)
+}
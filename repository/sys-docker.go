@@ -16,6 +16,9 @@ func DockerIsAvailable() bool {
  * Pull docker image, while echoing progress on terminal
  */
 func DockerPullImage(image string, tag string) error {
+  if err := CheckOnline(image + ":" + tag); err != nil {
+    return err
+  }
   exitcode, err := ExecuteAndPassthrough("docker", "pull", image + ":" + tag)
   if err != nil {
     return err
@@ -39,3 +42,14 @@ func DockerRemoveImage(image string, tag string) error {
   }
   return nil
 }
+
+/**
+ * Check if the docker image exists locally
+ */
+func DockerHasImage(image string, tag string) bool {
+  exitcode, err := ExecuteSilently("docker", "image", "inspect", image + ":" + tag)
+  if err != nil {
+    return false
+  }
+  return exitcode == 0
+}
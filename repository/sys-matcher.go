@@ -6,7 +6,8 @@ import (
 )
 
 /**
- * Return the failed requirement error message
+ * Return the failed requirement error message. Tool requirements never fail
+ * here, since they are satisfied by installing the tools they refer to.
  */
 func CollectRequirementErrors(req registry.ArtifactRequirement) []string {
   var errors []string = nil
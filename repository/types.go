@@ -21,7 +21,7 @@ type InstalledArtifact struct {
  * A version of an installed tool in the repository
  */
 type InstalledVersion struct {
-  Version     VersionTriplet
+  Version     SemVer
   Artifact    *InstalledArtifact
   Folder      string
 }
@@ -33,6 +33,13 @@ type InstalledTool struct {
   Versions    []InstalledVersion
   Name        string
   Folder      string
+
+  // The registry the tool was installed from, or empty for the tools that
+  // were installed before the tools were kept per registry
+  Registry    string
+
+  // The version directories in the layout of 0.1.1, that need migration
+  Legacy      []string
 }
 
 /**
@@ -70,6 +77,18 @@ func ArtifactID(a *registry.ToolArtifact) string {
   return ""
 }
 
+/**
+ * Return the key of the tool in the repository. Tools are qualified with the
+ * registry they were installed from (`registry/tool`), since more than one
+ * registry can have a tool with the same name.
+ */
+func ToolKey(registryName string, tool string) string {
+  if registryName == "" {
+    return tool
+  }
+  return registryName + "/" + tool
+}
+
 /**
  * Sanitize the tool name in order to resolve it to the folder name
  */
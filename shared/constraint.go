@@ -0,0 +1,275 @@
+package shared
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+)
+
+/**
+ * A primitive comparison against a version (eg. `>=1.2.0`)
+ */
+type versionComparator struct {
+  Op          string
+  Version     SemVer
+}
+
+/**
+ * A version constraint, in the syntax used by npm and cargo. It consists of
+ * sets of comparators separated by `||`, where every comparator of a set must
+ * be satisfied (eg. `^1.4 || >=2.1 <3`).
+ */
+type VersionConstraint struct {
+  text        string
+  sets        [][]versionComparator
+}
+
+/**
+ * Parse a partial version, where the missing components or the ones with a
+ * `x`, `X` or `*` wildcard are not specified (eg. `1.2.x`). Returns the
+ * version and the number of components that were specified.
+ */
+func parsePartialVersion(partial string) (SemVer, int, error) {
+  var components [3]uint64
+  given := 0
+
+  core := partial
+  if idx := strings.IndexAny(core, "-+"); idx >= 0 {
+    core = core[:idx]
+  }
+  for idx, fragStr := range strings.Split(core, ".") {
+    if idx > 2 {
+      return SemVer{}, 0, fmt.Errorf("invalid version '%s'", partial)
+    }
+    if fragStr == "x" || fragStr == "X" || fragStr == "*" {
+      break
+    }
+    if len(fragStr) > 1 && fragStr[0] == '0' {
+      return SemVer{}, 0, fmt.Errorf("invalid version '%s' (numbers can't have leading zeros)", partial)
+    }
+    fragInt, err := strconv.ParseUint(fragStr, 10, 64)
+    if err != nil {
+      return SemVer{}, 0, fmt.Errorf("invalid version '%s'", partial)
+    }
+    components[idx] = fragInt
+    given += 1
+  }
+
+  // Only complete versions can have a pre-release or build tag
+  if core != partial {
+    if given < 3 {
+      return SemVer{}, 0, fmt.Errorf("invalid version '%s'", partial)
+    }
+    ver, err := ParseSemVer(partial)
+    if err != nil {
+      return SemVer{}, 0, err
+    }
+    return *ver, given, nil
+  }
+
+  return NewSemVer(components[0], components[1], components[2]), given, nil
+}
+
+/**
+ * Return the smallest version that is greater than all the versions that
+ * start with the given components
+ */
+func nextPartialVersion(v SemVer, given int) SemVer {
+  switch given {
+    case 1:
+      return NewSemVer(v.Major + 1, 0, 0)
+    case 2:
+      return NewSemVer(v.Major, v.Minor + 1, 0)
+  }
+  return NewSemVer(v.Major, v.Minor, v.Patch + 1)
+}
+
+/**
+ * Expand a single comparator (eg. `^1.4`) to it's primitive comparisons
+ */
+func parseComparator(token string) ([]versionComparator, error) {
+  op := ""
+  for _, prefix := range []string{">=", "<=", ">", "<", "=", "~", "^"} {
+    if strings.HasPrefix(token, prefix) {
+      op = prefix
+      break
+    }
+  }
+  ver, given, err := parsePartialVersion(strings.TrimPrefix(token, op))
+  if err != nil {
+    return nil, err
+  }
+
+  // Wildcards match everything, except in ranges that exclude everything
+  if given == 0 {
+    if op == "<" || op == ">" {
+      return []versionComparator{{"<", NewSemVer(0, 0, 0)}}, nil
+    }
+    return []versionComparator{{">=", NewSemVer(0, 0, 0)}}, nil
+  }
+
+  switch op {
+    case "", "=":
+      if given == 3 {
+        return []versionComparator{{"=", ver}}, nil
+      }
+      return []versionComparator{{">=", ver}, {"<", nextPartialVersion(ver, given)}}, nil
+
+    case ">":
+      if given == 3 {
+        return []versionComparator{{">", ver}}, nil
+      }
+      return []versionComparator{{">=", nextPartialVersion(ver, given)}}, nil
+
+    case "<=":
+      if given == 3 {
+        return []versionComparator{{"<=", ver}}, nil
+      }
+      return []versionComparator{{"<", nextPartialVersion(ver, given)}}, nil
+
+    case ">=", "<":
+      return []versionComparator{{op, ver}}, nil
+
+    // Allow patch-level changes, or minor-level if the minor is not given
+    case "~":
+      if given == 1 {
+        return []versionComparator{{">=", ver}, {"<", nextPartialVersion(ver, 1)}}, nil
+      }
+      return []versionComparator{{">=", ver}, {"<", nextPartialVersion(ver, 2)}}, nil
+
+    // Allow changes that do not modify the left-most non-zero component
+    case "^":
+      upper := nextPartialVersion(ver, 1)
+      if ver.Major == 0 && given >= 2 {
+        upper = nextPartialVersion(ver, 2)
+        if ver.Minor == 0 && given == 3 {
+          upper = nextPartialVersion(ver, 3)
+        }
+      }
+      return []versionComparator{{">=", ver}, {"<", upper}}, nil
+  }
+
+  return nil, fmt.Errorf("invalid version constraint '%s'", token)
+}
+
+/**
+ * Parse a version constraint. A plain version (eg. `1.2`) matches all the
+ * versions that start with it.
+ */
+func ParseVersionConstraint(constraint string) (*VersionConstraint, error) {
+  c := &VersionConstraint{constraint, nil}
+
+  for _, setStr := range strings.Split(constraint, "||") {
+    var set []versionComparator
+
+    // Operators can be separated from their version, and comparators can be
+    // separated with commas as in cargo
+    tokens := strings.Fields(strings.Replace(setStr, ",", " ", -1))
+    for idx := 0; idx < len(tokens); idx++ {
+      token := tokens[idx]
+      if strings.Trim(token, "<>=~^") == "" && idx + 1 < len(tokens) {
+        idx += 1
+        token += tokens[idx]
+      }
+
+      comparators, err := parseComparator(token)
+      if err != nil {
+        return nil, fmt.Errorf("invalid version constraint '%s': %s", constraint, err.Error())
+      }
+      set = append(set, comparators...)
+    }
+
+    if len(set) == 0 {
+      set = []versionComparator{{">=", NewSemVer(0, 0, 0)}}
+    }
+    c.sets = append(c.sets, set)
+  }
+
+  return c, nil
+}
+
+/**
+ * Check if a primitive comparison is satisfied
+ */
+func (cmp versionComparator) Check(v SemVer) bool {
+  res := v.Compare(cmp.Version)
+  switch cmp.Op {
+    case "=":
+      return res == 0 && (cmp.Version.Build == "" || v.Build == cmp.Version.Build)
+    case ">":
+      return res > 0
+    case ">=":
+      return res >= 0
+    case "<":
+      return res < 0
+    case "<=":
+      return res <= 0
+  }
+  return false
+}
+
+/**
+ * Check if a set of comparators is satisfied
+ */
+func checkComparatorSet(set []versionComparator, v SemVer, anyPrerelease bool) bool {
+  for _, cmp := range set {
+    if !cmp.Check(v) {
+      return false
+    }
+  }
+
+  // Pre-releases only match if they are explicitly asked for, by a
+  // comparator with a pre-release on the same version
+  if v.IsPrerelease() && !anyPrerelease {
+    for _, cmp := range set {
+      if cmp.Version.IsPrerelease() &&
+          cmp.Version.Major == v.Major &&
+          cmp.Version.Minor == v.Minor &&
+          cmp.Version.Patch == v.Patch {
+        return true
+      }
+    }
+    return false
+  }
+
+  return true
+}
+
+/**
+ * Check if the version satisfies the constraint
+ */
+func (c *VersionConstraint) Check(v SemVer) bool {
+  for _, set := range c.sets {
+    if checkComparatorSet(set, v, false) {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Check if the version satisfies the constraint, even if it's a pre-release
+ * that was not explicitly asked for
+ */
+func (c *VersionConstraint) CheckIncludingPrereleases(v SemVer) bool {
+  for _, set := range c.sets {
+    if checkComparatorSet(set, v, true) {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Get the constraint as string
+ */
+func (c *VersionConstraint) ToString() string {
+  return c.text
+}
+
+/**
+ * Check if the constraint asks for a single, specific version
+ */
+func (c *VersionConstraint) IsExact() bool {
+  return len(c.sets) == 1 && len(c.sets[0]) == 1 && c.sets[0][0].Op == "="
+}
@@ -0,0 +1,207 @@
+package shared
+
+import (
+  "testing"
+)
+
+func mustParseSemVer(t *testing.T, version string) SemVer {
+  ver, err := ParseSemVer(version)
+  if err != nil {
+    t.Fatalf("cannot parse version '%s': %s", version, err.Error())
+  }
+  return *ver
+}
+
+func TestVersionConstraintCheck(t *testing.T) {
+  tests := []struct {
+    constraint  string
+    version     string
+    expected    bool
+  }{
+    // Plain and partial versions
+    {"1.2.3", "1.2.3", true},
+    {"1.2.3", "1.2.4", false},
+    {"1.2", "1.2.9", true},
+    {"1.2", "1.3.0", false},
+    {"1.x", "1.9.9", true},
+    {"1.x", "2.0.0", false},
+    {"*", "3.1.4", true},
+    {"", "0.0.1", true},
+
+    // Comparison operators
+    {">1.2.3", "1.2.4", true},
+    {">1.2.3", "1.2.3", false},
+    {">1.2", "1.2.9", false},
+    {">1.2", "1.3.0", true},
+    {"<=1.2", "1.2.9", true},
+    {"<=1.2", "1.3.0", false},
+    {">= 1.2, < 2", "1.9.0", true},
+    {">= 1.2, < 2", "2.0.0", false},
+
+    // Tilde ranges
+    {"~1", "1.0.0", true},
+    {"~1", "1.9.9", true},
+    {"~1", "2.0.0", false},
+    {"~1.2", "1.2.9", true},
+    {"~1.2", "1.3.0", false},
+    {"~1.2.3", "1.2.2", false},
+    {"~1.2.3", "1.2.9", true},
+
+    // Caret ranges
+    {"^1.2.3", "1.9.0", true},
+    {"^1.2.3", "2.0.0", false},
+    {"^0.2.3", "0.2.9", true},
+    {"^0.2.3", "0.3.0", false},
+    {"^0.0.3", "0.0.3", true},
+    {"^0.0.3", "0.0.4", false},
+    {"^0.0.x", "0.0.0", true},
+    {"^0.0.x", "0.0.9", true},
+    {"^0.0.x", "0.1.0", false},
+    {"^0.0", "0.0.9", true},
+    {"^0.0", "0.1.0", false},
+    {"^0", "0.9.9", true},
+    {"^0", "1.0.0", false},
+
+    // Alternatives
+    {"^1.4 || >=2.1 <3", "1.5.0", true},
+    {"^1.4 || >=2.1 <3", "2.0.0", false},
+    {"^1.4 || >=2.1 <3", "2.5.0", true},
+
+    // Pre-releases only match when asked for on the same version
+    {"^1.2", "1.3.0-beta", false},
+    {">=1.2.3-beta", "1.2.3-rc.1", true},
+    {">=1.2.3-beta", "1.2.3-alpha", false},
+    {">=1.2.3-beta", "1.2.4-beta", false},
+    {">=1.2.3-beta", "1.2.4", true},
+    {"1.2.3-beta", "1.2.3-beta", true},
+  }
+
+  for _, test := range tests {
+    constraint, err := ParseVersionConstraint(test.constraint)
+    if err != nil {
+      t.Errorf("'%s': unexpected error: %s", test.constraint, err.Error())
+      continue
+    }
+    version := mustParseSemVer(t, test.version)
+    if actual := constraint.Check(version); actual != test.expected {
+      t.Errorf("'%s' on %s: expected %t, got %t", test.constraint, test.version, test.expected, actual)
+    }
+  }
+}
+
+func TestVersionConstraintCheckIncludingPrereleases(t *testing.T) {
+  tests := []struct {
+    constraint  string
+    version     string
+    expected    bool
+  }{
+    {"^1.2", "1.3.0-beta", true},
+    {"^1.2", "1.2.0-beta", false},
+    {"~1.2.3", "1.2.4-rc.1", true},
+  }
+
+  for _, test := range tests {
+    constraint, err := ParseVersionConstraint(test.constraint)
+    if err != nil {
+      t.Errorf("'%s': unexpected error: %s", test.constraint, err.Error())
+      continue
+    }
+    version := mustParseSemVer(t, test.version)
+    if actual := constraint.CheckIncludingPrereleases(version); actual != test.expected {
+      t.Errorf("'%s' on %s: expected %t, got %t", test.constraint, test.version, test.expected, actual)
+    }
+  }
+}
+
+func TestParseVersionConstraintErrors(t *testing.T) {
+  tests := []string{
+    "1.2.3.4",
+    "abc",
+    "^1.x-beta",
+    ">=1.2 || ~",
+    "1.2.3-01",
+    "01.2",
+    "^1.02",
+    "~1.02",
+    "01.2.3",
+    ">=1.2 <02",
+  }
+
+  for _, test := range tests {
+    if _, err := ParseVersionConstraint(test); err == nil {
+      t.Errorf("'%s': expected an error", test)
+    }
+  }
+}
+
+func TestVersionConstraintIsExact(t *testing.T) {
+  tests := []struct {
+    constraint  string
+    expected    bool
+  }{
+    {"1.2.3", true},
+    {"=1.2.3", true},
+    {"1.2", false},
+    {"^1.2.3", false},
+    {"1.2.3 || 1.2.4", false},
+  }
+
+  for _, test := range tests {
+    constraint, err := ParseVersionConstraint(test.constraint)
+    if err != nil {
+      t.Errorf("'%s': unexpected error: %s", test.constraint, err.Error())
+      continue
+    }
+    if actual := constraint.IsExact(); actual != test.expected {
+      t.Errorf("'%s': expected %t, got %t", test.constraint, test.expected, actual)
+    }
+  }
+}
+
+func TestSemVerPrereleaseOrdering(t *testing.T) {
+  // In ascending order, as given by the semver specification
+  ordered := []string{
+    "1.0.0-alpha",
+    "1.0.0-alpha.1",
+    "1.0.0-alpha.beta",
+    "1.0.0-beta",
+    "1.0.0-beta.2",
+    "1.0.0-beta.11",
+    "1.0.0-rc.1",
+    "1.0.0",
+    "1.0.1",
+  }
+
+  for idx := 0; idx + 1 < len(ordered); idx++ {
+    a := mustParseSemVer(t, ordered[idx])
+    b := mustParseSemVer(t, ordered[idx + 1])
+    if a.Compare(b) >= 0 || b.Compare(a) <= 0 {
+      t.Errorf("expected %s < %s", ordered[idx], ordered[idx + 1])
+    }
+  }
+
+  // Build metadata does not affect the precedence
+  if mustParseSemVer(t, "1.0.0+build.1").Compare(mustParseSemVer(t, "1.0.0+build.2")) != 0 {
+    t.Errorf("expected the build metadata to be ignored")
+  }
+}
+
+func TestParseSemVerErrors(t *testing.T) {
+  tests := []string{
+    "",
+    "1.2.3.4",
+    "01.2.3",
+    "1.02.3",
+    "1.2.03",
+    "1.2.3-",
+    "1.2.3-01",
+    "1.2.3+",
+    "v1.2.3",
+  }
+
+  for _, test := range tests {
+    if _, err := ParseSemVer(test); err == nil {
+      t.Errorf("'%s': expected an error", test)
+    }
+  }
+}
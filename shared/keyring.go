@@ -0,0 +1,255 @@
+package shared
+
+import (
+  "bytes"
+  "crypto"
+  "crypto/ecdsa"
+  "crypto/ed25519"
+  "crypto/elliptic"
+  "crypto/rsa"
+  "crypto/sha256"
+  "crypto/x509"
+  "encoding/hex"
+  "encoding/json"
+  "encoding/pem"
+  "fmt"
+  "sort"
+)
+
+/**
+ * The supported signature algorithms. All of them sign the SHA256 digest of
+ * the contents, so the contents can be verified while they are streamed.
+ */
+const (
+  RSAPSSWithSHA256      = "rsa-pss-sha256"
+  ECDSAP256WithSHA256   = "ecdsa-p256-sha256"
+  Ed25519WithSHA256     = "ed25519-sha256"
+)
+
+/**
+ * A set of trusted public keys, by key ID
+ */
+type Keyring struct {
+  Keys        map[string]crypto.PublicKey
+}
+
+/**
+ * A detached signature, along with the ID of the key that created it and
+ * the algorithm it was created with
+ */
+type Signature struct {
+  KeyID       string    `json:"keyId"`
+  Algorithm   string    `json:"alg,omitempty"`
+  Signature   []byte    `json:"signature"`
+}
+
+/**
+ * Create an empty keyring
+ */
+func NewKeyring() *Keyring {
+  return &Keyring{make(map[string]crypto.PublicKey)}
+}
+
+/**
+ * Return the signature algorithm that is used with the given key, or an
+ * empty string if the key is not supported
+ */
+func KeyAlgorithm(pub crypto.PublicKey) string {
+  switch key := pub.(type) {
+    case *rsa.PublicKey:
+      return RSAPSSWithSHA256
+    case *ecdsa.PublicKey:
+      if key.Curve == elliptic.P256() {
+        return ECDSAP256WithSHA256
+      }
+    case ed25519.PublicKey:
+      return Ed25519WithSHA256
+  }
+  return ""
+}
+
+/**
+ * Calculate the ID of a public key, from the hash of it's DER encoding
+ */
+func KeyID(pub crypto.PublicKey) string {
+  der, err := x509.MarshalPKIXPublicKey(pub)
+  if err != nil {
+    return ""
+  }
+  sum := sha256.Sum256(der)
+  return hex.EncodeToString(sum[:8])
+}
+
+/**
+ * Parse a PEM-encoded RSA, ECDSA P-256 or Ed25519 public key
+ */
+func ParsePublicKeyPEM(pubPEM []byte) (crypto.PublicKey, error) {
+  block, _ := pem.Decode(pubPEM)
+  if block == nil {
+    return nil, fmt.Errorf("failed to parse PEM block containing the public key")
+  }
+  return parsePublicKeyBlock(block)
+}
+
+/**
+ * Parse the public key of a PEM block
+ */
+func parsePublicKeyBlock(block *pem.Block) (crypto.PublicKey, error) {
+  pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+  if err != nil {
+    return nil, fmt.Errorf("failed to parse DER encoded public key: %s", err.Error())
+  }
+
+  if KeyAlgorithm(pub) == "" {
+    return nil, fmt.Errorf("public key is not an RSA, ECDSA P-256 or Ed25519 key")
+  }
+
+  return pub, nil
+}
+
+/**
+ * Create a keyring with all the public keys in the PEM contents
+ */
+func ParseKeyringPEM(keysPEM []byte) (*Keyring, error) {
+  keys := NewKeyring()
+  rest := keysPEM
+  for {
+    var block *pem.Block
+    block, rest = pem.Decode(rest)
+    if block == nil {
+      break
+    }
+    pub, err := parsePublicKeyBlock(block)
+    if err != nil {
+      return nil, err
+    }
+    keys.Add(pub)
+  }
+
+  if len(keys.Keys) == 0 {
+    return nil, fmt.Errorf("failed to parse PEM block containing the public key")
+  }
+  return keys, nil
+}
+
+/**
+ * Trust the given key and return it's ID
+ */
+func (k *Keyring) Add(pub crypto.PublicKey) string {
+  id := KeyID(pub)
+  k.Keys[id] = pub
+  return id
+}
+
+/**
+ * Stop trusting the key with the given ID
+ */
+func (k *Keyring) Remove(id string) {
+  delete(k.Keys, id)
+}
+
+/**
+ * Return a copy of the keyring that can be changed independently
+ */
+func (k *Keyring) Clone() *Keyring {
+  keys := NewKeyring()
+  for id, pub := range k.Keys {
+    keys.Keys[id] = pub
+  }
+  return keys
+}
+
+/**
+ * Return the IDs of the trusted keys, sorted
+ */
+func (k *Keyring) IDs() []string {
+  var ids []string
+  for id := range k.Keys {
+    ids = append(ids, id)
+  }
+  sort.Strings(ids)
+  return ids
+}
+
+/**
+ * Read a detached signature. Signatures created before the key IDs were
+ * introduced are raw signatures, without a key ID or algorithm.
+ */
+func ParseSignature(sig []byte) Signature {
+  var envelope Signature
+  if bytes.HasPrefix(sig, []byte("{")) {
+    if err := json.Unmarshal(sig, &envelope); err == nil && envelope.Signature != nil {
+      return envelope
+    }
+  }
+  return Signature{"", "", sig}
+}
+
+/**
+ * Encode the detached signature
+ */
+func (s Signature) Bytes() ([]byte, error) {
+  return json.Marshal(s)
+}
+
+/**
+ * Verify the signature of a SHA256 digest with the given key. Signatures
+ * without an algorithm use the algorithm of the key.
+ */
+func verifyDigest(sum []byte, signature Signature, pub crypto.PublicKey) error {
+  algorithm := KeyAlgorithm(pub)
+  if signature.Algorithm != "" && signature.Algorithm != algorithm {
+    return fmt.Errorf("content is signed with %s, but the key expects %s", signature.Algorithm, algorithm)
+  }
+
+  valid := false
+  switch key := pub.(type) {
+    case *rsa.PublicKey:
+      var opts rsa.PSSOptions
+      valid = rsa.VerifyPSS(key, crypto.SHA256, sum, signature.Signature, &opts) == nil
+    case *ecdsa.PublicKey:
+      valid = ecdsa.VerifyASN1(key, sum, signature.Signature)
+    case ed25519.PublicKey:
+      valid = ed25519.Verify(key, sum, signature.Signature)
+  }
+  if !valid {
+    return fmt.Errorf("content signature cannot be verified")
+  }
+  return nil
+}
+
+/**
+ * Verify the detached signature of a SHA256 digest against the key that
+ * created it, or against every trusted key if the signature has no key ID
+ */
+func (k *Keyring) VerifyDigest(sum []byte, sig []byte) error {
+  signature := ParseSignature(sig)
+  switch signature.Algorithm {
+    case "", RSAPSSWithSHA256, ECDSAP256WithSHA256, Ed25519WithSHA256:
+    default:
+      return fmt.Errorf("content is signed with the unsupported algorithm %s", signature.Algorithm)
+  }
+
+  if signature.KeyID != "" {
+    pub, ok := k.Keys[signature.KeyID]
+    if !ok {
+      return fmt.Errorf("content is signed with the untrusted key %s", signature.KeyID)
+    }
+    return verifyDigest(sum, signature, pub)
+  }
+
+  for _, id := range k.IDs() {
+    if verifyDigest(sum, signature, k.Keys[id]) == nil {
+      return nil
+    }
+  }
+  return fmt.Errorf("content signature cannot be verified")
+}
+
+/**
+ * Verify the detached signature of contents that are already read
+ */
+func (k *Keyring) Verify(contents []byte, sig []byte) error {
+  sum := sha256.Sum256(contents)
+  return k.VerifyDigest(sum[:], sig)
+}
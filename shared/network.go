@@ -5,8 +5,6 @@ import (
   "bufio"
   "compress/bzip2"
   "compress/gzip"
-  "crypto"
-  "crypto/rsa"
   "crypto/sha256"
   "encoding/hex"
   "fmt"
@@ -18,6 +16,8 @@ import (
   "path/filepath"
   "strconv"
   "strings"
+  "sync"
+  "sync/atomic"
   "time"
 )
 
@@ -28,6 +28,17 @@ type CloseFunc = func() error
 type StreamMeta struct {
   ContentLength         int
   ContentEncoding       string
+
+  // The cache validators of the resource
+  ETag                  string
+  LastModified          string
+
+  // The server responded that the resource has not changed since the
+  // validators given in the request
+  NotModified           bool
+
+  // The HTTP status the server responded with
+  StatusCode            int
 }
 type NetworkStreamChain struct {
   Reader                io.Reader
@@ -43,6 +54,21 @@ const (
    IgnoreErrors         DownloadFlags = 2
 )
 
+/**
+ * When set, every network request fails instead of touching the network
+ */
+var Offline = false
+
+/**
+ * Fail if we are not allowed to touch the network
+ */
+func CheckOnline(url string) error {
+  if Offline {
+    return fmt.Errorf("cannot reach %s in offline mode", url)
+  }
+  return nil
+}
+
 /**
  * A customized HTTP client
  */
@@ -56,17 +82,62 @@ func getHttpClient(disableCompression bool) *http.Client {
 }
 
 
+/**
+ * Return a chain that fails with the given error
+ */
+func failedStream(err error) NetworkStreamChain {
+  return NetworkStreamChain{
+    nil,
+    err,
+    StreamMeta{},
+    func () error {
+      return nil
+    },
+  }
+}
+
 /**
  * Start a network stream
  */
 func Download(url string, flags DownloadFlags) NetworkStreamChain {
+  return DownloadWithHeaders(url, nil, flags)
+}
+
+/**
+ * Start a network stream, sending the given request headers (eg. the
+ * `If-None-Match` header of a conditional request)
+ */
+func DownloadWithHeaders(url string, headers map[string]string, flags DownloadFlags) NetworkStreamChain {
+  if err := CheckOnline(url); err != nil {
+    return failedStream(err)
+  }
+  req, err := http.NewRequest("GET", url, nil)
+  if err != nil {
+    return failedStream(fmt.Errorf("could not request %s: %s", url, err.Error()))
+  }
+  for name, value := range headers {
+    req.Header.Set(name, value)
+  }
+
   client := getHttpClient((flags & WithoutCompression) != 0)
-  resp, err := client.Get(url)
+  resp, err := client.Do(req)
   if err != nil {
+    return failedStream(fmt.Errorf("could not request %s: %s", url, err.Error()))
+  }
+
+  // The resource has not changed since the last request, so there is nothing
+  // to read
+  if resp.StatusCode == http.StatusNotModified {
+    resp.Body.Close()
     return NetworkStreamChain{
+      strings.NewReader(""),
       nil,
-      fmt.Errorf("could not request %s: %s", url, err.Error()),
-      StreamMeta{},
+      StreamMeta{
+        ETag: resp.Header.Get("ETag"),
+        LastModified: resp.Header.Get("Last-Modified"),
+        NotModified: true,
+        StatusCode: resp.StatusCode,
+      },
       func () error {
         return nil
       },
@@ -79,7 +150,7 @@ func Download(url string, flags DownloadFlags) NetworkStreamChain {
       return NetworkStreamChain{
         nil,
         fmt.Errorf("server responded with: %s", resp.Status),
-        StreamMeta{},
+        StreamMeta{StatusCode: resp.StatusCode},
         func () error {
           return resp.Body.Close()
         },
@@ -101,8 +172,11 @@ func Download(url string, flags DownloadFlags) NetworkStreamChain {
     resp.Body,
     nil,
     StreamMeta{
-      contentLength,
-      contentEncoding,
+      ContentLength: contentLength,
+      ContentEncoding: contentEncoding,
+      ETag: resp.Header.Get("ETag"),
+      LastModified: resp.Header.Get("Last-Modified"),
+      StatusCode: resp.StatusCode,
     },
     func () error {
       return resp.Body.Close()
@@ -146,9 +220,68 @@ func (stream NetworkStreamChain) AndValidateChecksum(checksum string) NetworkStr
 }
 
 /**
- * Also validate the signature
+ * A reader that fails once it's stream is cancelled
+ */
+type cancelReader struct {
+  reader      io.Reader
+  cancelled   *int32
+}
+
+func (r cancelReader) Read(p []byte) (int, error) {
+  if atomic.LoadInt32(r.cancelled) != 0 {
+    return 0, fmt.Errorf("interrupted")
+  }
+  n, err := r.reader.Read(p)
+  if err != nil && atomic.LoadInt32(r.cancelled) != 0 {
+    return n, fmt.Errorf("interrupted")
+  }
+  return n, err
+}
+
+/**
+ * Also abort the stream as soon as the given channel is closed (eg. when the
+ * user interrupts the operation), instead of waiting for it to complete
+ */
+func (stream NetworkStreamChain) AndCancelOn(cancel <-chan struct{}) NetworkStreamChain {
+  if stream.Err != nil {
+    return stream
+  }
+
+  // Closing the stream unblocks the pending reads
+  var cancelled int32
+  var once sync.Once
+  done := make(chan struct{})
+  go func() {
+    select {
+      case <-cancel:
+        atomic.StoreInt32(&cancelled, 1)
+        stream.Close()
+      case <-done:
+    }
+  }()
+
+  // Return chain
+  return NetworkStreamChain{
+    cancelReader{stream.Reader, &cancelled},
+    nil,
+    stream.Meta,
+    func () error {
+      once.Do(func() {
+        close(done)
+      })
+      err := stream.Close()
+      if atomic.LoadInt32(&cancelled) != 0 {
+        return fmt.Errorf("interrupted")
+      }
+      return err
+    },
+  }
+}
+
+/**
+ * Also validate the detached signature against the trusted keys
  */
-func (stream NetworkStreamChain) AndValidatePSSSignature(sig []byte, pub *rsa.PublicKey) NetworkStreamChain {
+func (stream NetworkStreamChain) AndValidateSignature(sig []byte, keys *Keyring) NetworkStreamChain {
   if stream.Err != nil {
     return stream
   }
@@ -164,20 +297,16 @@ func (stream NetworkStreamChain) AndValidatePSSSignature(sig []byte, pub *rsa.Pu
     nil,
     stream.Meta,
     func () error {
+      // The signature covers everything, even what a de-compressor that
+      // reads from us has left unread
+      io.Copy(ioutil.Discard, proxyReader)
       err := stream.Close()
       if err != nil {
         return err
       }
 
-      // Verify PSS signature
-      var opts rsa.PSSOptions
-      sum := hasher.Sum(nil)
-      err = rsa.VerifyPSS(pub, crypto.SHA256, sum, sig, &opts)
-      if err != nil {
-        return fmt.Errorf("content signature cannot be verified")
-      }
-
-      return nil
+      // Verify the signature
+      return keys.VerifyDigest(hasher.Sum(nil), sig)
     },
   }
 }
@@ -411,3 +540,25 @@ func (stream NetworkStreamChain) EventuallyReadAll() ([]byte, error) {
 
   return byt, nil
 }
+
+/**
+ * Read the stream contents and return their SHA256 checksum
+ */
+func (stream NetworkStreamChain) EventuallyChecksum() (string, error) {
+  if stream.Err != nil {
+    return "", stream.Err
+  }
+
+  hasher := sha256.New()
+  if _, err := io.Copy(hasher, stream.Reader); err != nil {
+    stream.Close()
+    return "", err
+  }
+
+  err := stream.Close()
+  if err != nil {
+    return "", err
+  }
+
+  return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,38 @@
+package shared
+
+import (
+  "encoding/json"
+  "fmt"
+)
+
+/**
+ * The name of the release asset that lists the checksums of the other assets
+ */
+const ReleaseManifestName = "release.json"
+
+/**
+ * The signed manifest of a release. It binds the version to the checksums of
+ * the binaries, so a binary of another (eg. older) release can't be passed
+ * off as this one.
+ */
+type ReleaseManifest struct {
+  Version     SemVer              `json:"version"`
+
+  // The SHA256 checksum of every asset, by asset name
+  Assets      map[string]string   `json:"assets"`
+}
+
+/**
+ * Parse the manifest of a release, after verifying it's signature
+ */
+func ParseReleaseManifest(byt []byte, sig []byte, keys *Keyring) (*ReleaseManifest, error) {
+  if err := keys.Verify(byt, sig); err != nil {
+    return nil, fmt.Errorf("invalid release manifest: %s", err.Error())
+  }
+
+  manifest := new(ReleaseManifest)
+  if err := json.Unmarshal(byt, manifest); err != nil {
+    return nil, fmt.Errorf("invalid release manifest: %s", err.Error())
+  }
+  return manifest, nil
+}
@@ -5,6 +5,7 @@ import (
   "bufio"
   "syscall"
   "os"
+  "strings"
   "golang.org/x/crypto/ssh/terminal"
 )
 
@@ -25,12 +26,12 @@ func PasswordPrompt(prompt string) ([]byte, error) {
 }
 
 /**
- * Read an arbitrary input from the user
+ * Read an arbitrary line from the user, without the trailing new line
  */
 func InputPrompt(prompt string) string {
   reader := bufio.NewReader(os.Stdin)
 
-  fmt.Print("Enter Username: ")
+  fmt.Print(prompt)
   input, _ := reader.ReadString('\n')
-  return input
+  return strings.TrimSpace(input)
 }
@@ -1,63 +1,250 @@
 package shared
 
 import (
+  "encoding/json"
   "fmt"
   "strings"
   "strconv"
 )
 
 /**
- * Version representation
+ * Semantic version representation (see https://semver.org)
  */
-type VersionTriplet   [3]float64
+type SemVer struct {
+  Major       uint64
+  Minor       uint64
+  Patch       uint64
+
+  // The dot-separated identifiers of the pre-release tag
+  Prerelease  []string
+
+  // The build metadata, that does not take part in the precedence
+  Build       string
+}
+
+/**
+ * Create a version without pre-release or build tags
+ */
+func NewSemVer(major uint64, minor uint64, patch uint64) SemVer {
+  return SemVer{Major: major, Minor: minor, Patch: patch}
+}
 
 /**
  * Get the version as string
  */
-func (v VersionTriplet) ToString() string {
-  return fmt.Sprintf("%d.%d.%d",
-    uint32(v[0]),
-    uint32(v[1]),
-    uint32(v[2]))
+func (v SemVer) ToString() string {
+  s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+  if len(v.Prerelease) > 0 {
+    s += "-" + strings.Join(v.Prerelease, ".")
+  }
+  if v.Build != "" {
+    s += "+" + v.Build
+  }
+  return s
+}
+
+/**
+ * Check if a pre-release or build identifier is valid
+ */
+func isValidIdentifier(ident string) bool {
+  if ident == "" {
+    return false
+  }
+  for _, c := range ident {
+    if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && c != '-' {
+      return false
+    }
+  }
+  return true
+}
+
+/**
+ * Check if an identifier consists only of digits
+ */
+func isNumericIdentifier(ident string) bool {
+  for _, c := range ident {
+    if c < '0' || c > '9' {
+      return false
+    }
+  }
+  return true
 }
 
 /**
- * Parse a version string to a version info structure
+ * Parse a version string to a version info structure. For compatibility with
+ * the older versions, the minor and patch components can be omitted (eg. `1.2`
+ * is `1.2.0`).
  */
-func VersionFromString(version string) (*VersionTriplet, error) {
-  verInfo := new(VersionTriplet)
-  verFrag := strings.SplitN(version, ".", 3)
+func ParseSemVer(version string) (*SemVer, error) {
+  verInfo := new(SemVer)
+  core := version
 
+  // Split build metadata and pre-release tag
+  if idx := strings.Index(core, "+"); idx >= 0 {
+    verInfo.Build = core[idx+1:]
+    core = core[:idx]
+    for _, ident := range strings.Split(verInfo.Build, ".") {
+      if !isValidIdentifier(ident) {
+        return nil, fmt.Errorf("invalid build metadata in version '%s'", version)
+      }
+    }
+  }
+  if idx := strings.Index(core, "-"); idx >= 0 {
+    verInfo.Prerelease = strings.Split(core[idx+1:], ".")
+    core = core[:idx]
+    for _, ident := range verInfo.Prerelease {
+      if !isValidIdentifier(ident) ||
+          (len(ident) > 1 && ident[0] == '0' && isNumericIdentifier(ident)) {
+        return nil, fmt.Errorf("invalid pre-release tag in version '%s'", version)
+      }
+    }
+  }
+
+  // Parse the numeric components
+  verFrag := strings.Split(core, ".")
+  if len(verFrag) > 3 {
+    return nil, fmt.Errorf("invalid version '%s'", version)
+  }
+  components := []*uint64{&verInfo.Major, &verInfo.Minor, &verInfo.Patch}
   for idx, fragStr := range verFrag {
-    fragInt, err := strconv.Atoi(fragStr)
+    if len(fragStr) > 1 && fragStr[0] == '0' {
+      return nil, fmt.Errorf("invalid version '%s' (numbers can't have leading zeros)", version)
+    }
+    fragInt, err := strconv.ParseUint(fragStr, 10, 64)
     if err != nil {
-      return nil, err
+      return nil, fmt.Errorf("invalid version '%s'", version)
     }
-    verInfo[idx] = float64(fragInt)
+    *components[idx] = fragInt
   }
 
   return verInfo, nil
 }
 
 /**
- * Compare two versions
+ * Compare two pre-release tags, according to the semver precedence rules
  */
-func (v VersionTriplet) Equals(n VersionTriplet) bool {
-  return v[0] == n[0] &&
-         v[1] == n[1] &&
-         v[2] == n[2]
+func comparePrerelease(a []string, b []string) int {
+  // A version without pre-release has higher precedence
+  if len(a) == 0 && len(b) == 0 {
+    return 0
+  } else if len(a) == 0 {
+    return 1
+  } else if len(b) == 0 {
+    return -1
+  }
+
+  for idx := 0; idx < len(a) && idx < len(b); idx++ {
+    aNum, aErr := strconv.ParseUint(a[idx], 10, 64)
+    bNum, bErr := strconv.ParseUint(b[idx], 10, 64)
+    switch {
+      case aErr == nil && bErr == nil:
+        if aNum != bNum {
+          if aNum < bNum {
+            return -1
+          }
+          return 1
+        }
+
+      // Numeric identifiers have lower precedence than alphanumeric ones
+      case aErr == nil:
+        return -1
+      case bErr == nil:
+        return 1
+
+      default:
+        if c := strings.Compare(a[idx], b[idx]); c != 0 {
+          return c
+        }
+    }
+  }
+
+  // A larger set of identifiers has higher precedence
+  if len(a) < len(b) {
+    return -1
+  } else if len(a) > len(b) {
+    return 1
+  }
+  return 0
+}
+
+/**
+ * Compare two versions according to their precedence, returning -1, 0 or 1
+ * if `v` is lower, equal or higher than `n`. The build metadata is ignored.
+ */
+func (v SemVer) Compare(n SemVer) int {
+  for _, pair := range [][2]uint64{{v.Major, n.Major}, {v.Minor, n.Minor}, {v.Patch, n.Patch}} {
+    if pair[0] < pair[1] {
+      return -1
+    } else if pair[0] > pair[1] {
+      return 1
+    }
+  }
+  return comparePrerelease(v.Prerelease, n.Prerelease)
+}
+
+/**
+ * Compare two versions, including their build metadata
+ */
+func (v SemVer) Equals(n SemVer) bool {
+  return v.Compare(n) == 0 && v.Build == n.Build
 }
 
 /**
  * Compare two versions
  */
-func (v VersionTriplet) LessThan(n * VersionTriplet) bool {
-  var left float64 = v[0] * 1000000 + v[1] * 1000 + v[2]
-  var right float64 = n[0] * 1000000 + n[1] * 1000 + n[2]
-  return left < right
+func (v SemVer) LessThan(n *SemVer) bool {
+  return v.Compare(*n) < 0
+}
+func (v SemVer) GreaterThan(n *SemVer) bool {
+  return v.Compare(*n) > 0
 }
-func (v VersionTriplet) GraterThan(n * VersionTriplet) bool {
-  var left float64 = v[0] * 1000000 + v[1] * 1000 + v[2]
-  var right float64 = n[0] * 1000000 + n[1] * 1000 + n[2]
-  return left > right
+
+/**
+ * Check if the version is a pre-release
+ */
+func (v SemVer) IsPrerelease() bool {
+  return len(v.Prerelease) > 0
+}
+
+/**
+ * Versions without pre-release or build tags are written as a
+ * `[major, minor, patch]` array, so older clients can still read them
+ */
+func (v SemVer) MarshalJSON() ([]byte, error) {
+  if !v.IsPrerelease() && v.Build == "" {
+    return json.Marshal([3]uint64{v.Major, v.Minor, v.Patch})
+  }
+  return json.Marshal(v.ToString())
+}
+
+/**
+ * Read either a version string, or a legacy `[major, minor, patch]` array
+ */
+func (v *SemVer) UnmarshalJSON(data []byte) error {
+  var legacy []float64
+  if err := json.Unmarshal(data, &legacy); err == nil {
+    if len(legacy) > 3 {
+      return fmt.Errorf("invalid version %s", string(data))
+    }
+    var components [3]uint64
+    for idx, frag := range legacy {
+      if frag < 0 || frag != float64(uint64(frag)) {
+        return fmt.Errorf("invalid version %s", string(data))
+      }
+      components[idx] = uint64(frag)
+    }
+    *v = NewSemVer(components[0], components[1], components[2])
+    return nil
+  }
+
+  var s string
+  if err := json.Unmarshal(data, &s); err != nil {
+    return fmt.Errorf("invalid version %s", string(data))
+  }
+  ver, err := ParseSemVer(s)
+  if err != nil {
+    return err
+  }
+  *v = *ver
+  return nil
 }
@@ -1,19 +1,50 @@
 package main
 
 import (
+  "fmt"
+  "io/ioutil"
   "os/user"
-  "crypto/rsa"
-  "crypto/x509"
-  "encoding/pem"
+  "strings"
+  "time"
+  "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
 )
 
+/**
+ * The configuration of a registry
+ */
+type RegistryConfig struct {
+  Name                string    `json:"name"`
+  URL                 string    `json:"url"`
+
+  // The PEM-encoded public keys or the path to a PEM file. If missing, the
+  // public keys hard-coded in the tool are used.
+  PubKey              string    `json:"pubKey,omitempty"`
+}
+
 type ScrewdriverConfig struct {
-  UserBinDir          string
-  DataDir             string
-  RegistryURL         string
-  RegistryPubKey      *rsa.PublicKey
+  UserBinDir          string              `json:"userBinDir,omitempty"`
+  DataDir             string              `json:"dataDir,omitempty"`
+
+  // The registries to use, in order of precedence
+  Registries          []RegistryConfig    `json:"registries,omitempty"`
+
+  // The release channel to install the tools from
+  Channel             string              `json:"channel,omitempty"`
+
+  // How long the cached registries are used before checking for newer ones
+  // (eg. `1h` or `30m`)
+  RegistryTTL         string              `json:"registryTTL,omitempty"`
+
+  // Never touch the network, only use the cached registries
+  Offline             bool                `json:"offline,omitempty"`
 }
 
+/**
+ * How long the cached registries are used when nothing is configured
+ */
+const DefaultRegistryTTL = "1h"
+
 /**
  * Get the location of the registry
  */
@@ -34,10 +65,11 @@ func GetUserBinPath() (string, error) {
 }
 
 /**
- * Get the pre-shared public key
+ * The pre-shared public keys, trusted by the registries that have no key
+ * configured and by the self-upgrades. New keys are added here when they
+ * are rotated, and the retired ones are removed.
  */
-func GetHardCodedPublicKey() *rsa.PublicKey {
-  pubPEM := `
+const hardCodedKeysPEM = `
 -----BEGIN PUBLIC KEY-----
 MIICIjANBgkqhkiG9w0BAQEFAAOCAg8AMIICCgKCAgEAvjNE44H0+Y2PRrrZ7lgu
 UG0jDJ65qtBwDKRahf8skGoDOrbsavfL7Vojn9wnv2ZD35bmeyyY+eszPTgiyCeU
@@ -53,19 +85,86 @@ LXtsTgKvr9KCmRO9VV3+UoVyD9Q0S3b/r5BKxBDh0MfBlahHK5pHxmmUQK9RqNoV
 EJjLk3BgQ1/uRRnduijwSb0CAwEAAQ==
 -----END PUBLIC KEY-----`
 
-  // NOTE: This is a critical part of the program, so it's safer to panic
-  //       rather than returning the error to be handled
+/**
+ * Get the pre-shared public keys
+ */
+func GetHardCodedKeyring() (*Keyring, error) {
+  keys, err := ParseKeyringPEM([]byte(hardCodedKeysPEM))
+  if err != nil {
+    return nil, fmt.Errorf("invalid pre-shared public key: %s", err.Error())
+  }
+  return keys, nil
+}
 
-  block, _ := pem.Decode([]byte(pubPEM))
-  if block == nil {
-    panic("failed to parse PEM block containing the public key")
+/**
+ * Load the public keys of a registry, either from the PEM contents or the
+ * file given, falling back to the hard-coded keys if missing.
+ */
+func LoadRegistryKeyring(pubKey string) (*Keyring, error) {
+  if pubKey == "" {
+    return GetHardCodedKeyring()
   }
-  pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+  if strings.Contains(pubKey, "-----BEGIN") {
+    return ParseKeyringPEM([]byte(pubKey))
+  }
+
+  byt, err := ioutil.ReadFile(ExpandHomeDir(pubKey))
   if err != nil {
-    panic("failed to parse DER encoded public key: " + err.Error())
+    return nil, fmt.Errorf("unable to load public key: %s", err.Error())
   }
+  return ParseKeyringPEM(byt)
+}
+
+/**
+ * Return the registry sources that correspond to the configured registries
+ */
+func (config *ScrewdriverConfig) RegistrySources() ([]registry.RegistrySource, error) {
+  var sources []registry.RegistrySource
+
+  for _, reg := range config.Registries {
+    if reg.URL == "" {
+      return nil, fmt.Errorf("registry '%s' has no URL configured", reg.Name)
+    }
+
+    keys, err := LoadRegistryKeyring(reg.PubKey)
+    if err != nil {
+      return nil, fmt.Errorf("registry '%s': %s", reg.Name, err.Error())
+    }
+
+    sources = append(sources, registry.RegistrySource{
+      Name: reg.Name,
+      URL: reg.URL,
+      Keys: keys,
+    })
+  }
+
+  return sources, nil
+}
 
-  return pub.(*rsa.PublicKey)
+/**
+ * Parse the TTL of the cached registries
+ */
+func ParseRegistryTTL(value string) (time.Duration, error) {
+  ttl, err := time.ParseDuration(value)
+  if err != nil || ttl < 0 {
+    return 0, fmt.Errorf("invalid registry TTL '%s' (expecting a duration, eg. `1h` or `30m`)", value)
+  }
+  return ttl, nil
+}
+
+/**
+ * Return how the registries should be fetched
+ */
+func (config *ScrewdriverConfig) FetchOptions() registry.FetchOptions {
+  // The TTL is validated when loaded, so this can only fail for the default
+  ttl, err := ParseRegistryTTL(config.RegistryTTL)
+  if err != nil {
+    ttl = time.Hour
+  }
+  return registry.FetchOptions{
+    TTL: ttl,
+    Offline: config.Offline,
+  }
 }
 
 /**
@@ -85,7 +184,15 @@ func GetDefaultConfig() (*ScrewdriverConfig, error) {
   return &ScrewdriverConfig{
     binPath,
     regPath,
-    "https://raw.githubusercontent.com/wavesoft/dcos-sonic-screwdriver-registry/master/registry.json",
-    GetHardCodedPublicKey(),
+    []RegistryConfig{
+      {
+        "default",
+        "https://raw.githubusercontent.com/wavesoft/dcos-sonic-screwdriver-registry/master/registry.json",
+        "",
+      },
+    },
+    registry.DefaultChannel,
+    DefaultRegistryTTL,
+    false,
   }, nil
 }
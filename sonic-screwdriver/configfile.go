@@ -0,0 +1,474 @@
+package main
+
+import (
+  "fmt"
+  "github.com/ghodss/yaml"
+  "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  "io/ioutil"
+  "os"
+  "os/user"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "unicode"
+)
+
+/**
+ * A configuration key that can be read or changed with `ss config`
+ */
+type ConfigKey struct {
+  Name        string
+  Get         func(config *ScrewdriverConfig) string
+  Set         func(config *ScrewdriverConfig, value string) error
+}
+
+/**
+ * The static configuration keys
+ */
+var configKeys = []ConfigKey{
+  {
+    "userBinDir",
+    func(config *ScrewdriverConfig) string {
+      return config.UserBinDir
+    },
+    func(config *ScrewdriverConfig, value string) error {
+      config.UserBinDir = ExpandHomeDir(value)
+      return nil
+    },
+  },
+  {
+    "dataDir",
+    func(config *ScrewdriverConfig) string {
+      return config.DataDir
+    },
+    func(config *ScrewdriverConfig, value string) error {
+      config.DataDir = ExpandHomeDir(value)
+      return nil
+    },
+  },
+  {
+    "channel",
+    func(config *ScrewdriverConfig) string {
+      return config.Channel
+    },
+    func(config *ScrewdriverConfig, value string) error {
+      if err := registry.CheckChannel(value); err != nil {
+        return err
+      }
+      config.Channel = value
+      return nil
+    },
+  },
+  {
+    "registryTTL",
+    func(config *ScrewdriverConfig) string {
+      return config.RegistryTTL
+    },
+    func(config *ScrewdriverConfig, value string) error {
+      if _, err := ParseRegistryTTL(value); err != nil {
+        return err
+      }
+      config.RegistryTTL = value
+      return nil
+    },
+  },
+  {
+    "offline",
+    func(config *ScrewdriverConfig) string {
+      return strconv.FormatBool(config.Offline)
+    },
+    func(config *ScrewdriverConfig, value string) error {
+      offline, err := strconv.ParseBool(value)
+      if err != nil {
+        return fmt.Errorf("invalid value '%s' (expecting `true` or `false`)", value)
+      }
+      config.Offline = offline
+      return nil
+    },
+  },
+  {
+    "registries",
+    func(config *ScrewdriverConfig) string {
+      var names []string
+      for _, reg := range config.Registries {
+        names = append(names, reg.Name)
+      }
+      return strings.Join(names, ",")
+    },
+    func(config *ScrewdriverConfig, value string) error {
+      return config.SetRegistryOrder(strings.Split(value, ","))
+    },
+  },
+}
+
+/**
+ * Expand the `~/` prefix to the user's home directory
+ */
+func ExpandHomeDir(path string) string {
+  if !strings.HasPrefix(path, "~/") {
+    return path
+  }
+  usr, err := user.Current()
+  if err != nil {
+    return path
+  }
+  return usr.HomeDir + path[1:]
+}
+
+/**
+ * Get the location of the configuration file
+ */
+func GetConfigFilePath() (string, error) {
+  if path := os.Getenv("SS_CONFIG"); path != "" {
+    return path, nil
+  }
+  if xdgDir := os.Getenv("XDG_CONFIG_HOME"); xdgDir != "" {
+    return xdgDir + "/sonic-screwdriver/config.yml", nil
+  }
+
+  usr, err := user.Current()
+  if err != nil {
+    return "", err
+  }
+  return usr.HomeDir + "/.config/sonic-screwdriver/config.yml", nil
+}
+
+/**
+ * Get the name of the environment variable that overrides the given key
+ * (eg. `userBinDir` -> `SS_USER_BIN_DIR`)
+ */
+func ConfigKeyEnvName(key string) string {
+  var builder strings.Builder
+  builder.WriteString("SS_")
+
+  prev := ' '
+  for _, c := range key {
+    if c == '.' || c == '-' {
+      builder.WriteRune('_')
+    } else {
+      if unicode.IsUpper(c) && unicode.IsLower(prev) {
+        builder.WriteRune('_')
+      }
+      builder.WriteRune(unicode.ToUpper(c))
+    }
+    prev = c
+  }
+
+  return builder.String()
+}
+
+/**
+ * Find the registry configuration with the given name
+ */
+func (config *ScrewdriverConfig) FindRegistry(name string) *RegistryConfig {
+  for idx, reg := range config.Registries {
+    if reg.Name == name {
+      return &config.Registries[idx]
+    }
+  }
+  return nil
+}
+
+/**
+ * Make sure the registry name can be used in tool names and configuration keys
+ */
+func checkRegistryName(name string) error {
+  if name == "" || strings.ContainsAny(name, "/.,") {
+    return fmt.Errorf("invalid registry name '%s'", name)
+  }
+  return nil
+}
+
+/**
+ * Re-arrange the registries to the order given, creating the missing ones
+ * and removing the ones not listed
+ */
+func (config *ScrewdriverConfig) SetRegistryOrder(names []string) error {
+  var registries []RegistryConfig
+
+  for _, name := range names {
+    name = strings.TrimSpace(name)
+    if name == "" {
+      continue
+    }
+    if err := checkRegistryName(name); err != nil {
+      return err
+    }
+
+    if reg := config.FindRegistry(name); reg != nil {
+      registries = append(registries, *reg)
+    } else {
+      registries = append(registries, RegistryConfig{Name: name})
+    }
+  }
+
+  config.Registries = registries
+  return nil
+}
+
+/**
+ * Return all the configuration keys, including the per-registry ones
+ */
+func (config *ScrewdriverConfig) Keys() []string {
+  var keys []string
+  for _, key := range configKeys {
+    keys = append(keys, key.Name)
+  }
+  for _, reg := range config.Registries {
+    keys = append(keys,
+      "registries." + reg.Name + ".url",
+      "registries." + reg.Name + ".pubKey")
+  }
+  return keys
+}
+
+/**
+ * Get the value of a configuration key
+ */
+func (config *ScrewdriverConfig) GetValue(key string) (string, error) {
+  for _, k := range configKeys {
+    if k.Name == key {
+      return k.Get(config), nil
+    }
+  }
+
+  // Per-registry keys
+  parts := strings.Split(key, ".")
+  if len(parts) == 3 && parts[0] == "registries" {
+    reg := config.FindRegistry(parts[1])
+    if reg == nil {
+      return "", fmt.Errorf("unknown registry '%s'", parts[1])
+    }
+    switch parts[2] {
+      case "url":
+        return reg.URL, nil
+      case "pubKey":
+        return reg.PubKey, nil
+    }
+  }
+
+  return "", fmt.Errorf("unknown configuration key '%s'", key)
+}
+
+/**
+ * Set the value of a configuration key
+ */
+func (config *ScrewdriverConfig) SetValue(key string, value string) error {
+  for _, k := range configKeys {
+    if k.Name == key {
+      return k.Set(config, value)
+    }
+  }
+
+  // Per-registry keys, creating the registry if it's missing
+  parts := strings.Split(key, ".")
+  if len(parts) == 3 && parts[0] == "registries" {
+    if config.FindRegistry(parts[1]) == nil {
+      if err := checkRegistryName(parts[1]); err != nil {
+        return err
+      }
+      config.Registries = append(config.Registries, RegistryConfig{Name: parts[1]})
+    }
+
+    reg := config.FindRegistry(parts[1])
+    switch parts[2] {
+      case "url":
+        reg.URL = value
+        return nil
+      case "pubKey":
+        reg.PubKey = value
+        return nil
+    }
+  }
+
+  return fmt.Errorf("unknown configuration key '%s'", key)
+}
+
+/**
+ * Override the configuration values from the `SS_*` environment variables
+ */
+func (config *ScrewdriverConfig) ApplyEnvironment() error {
+  // Static keys go first, since they can change the registry list
+  for _, k := range configKeys {
+    if value, ok := os.LookupEnv(ConfigKeyEnvName(k.Name)); ok {
+      if err := k.Set(config, value); err != nil {
+        return fmt.Errorf("%s: %s", ConfigKeyEnvName(k.Name), err.Error())
+      }
+    }
+  }
+
+  // Then per-registry keys
+  for _, key := range config.Keys() {
+    if value, ok := os.LookupEnv(ConfigKeyEnvName(key)); ok {
+      if err := config.SetValue(key, value); err != nil {
+        return fmt.Errorf("%s: %s", ConfigKeyEnvName(key), err.Error())
+      }
+    }
+  }
+
+  return nil
+}
+
+/**
+ * Read the keys that are set in the configuration file, without the defaults
+ */
+func ReadConfigFile(path string) (*ScrewdriverConfig, error) {
+  fileConfig := new(ScrewdriverConfig)
+  byt, err := ioutil.ReadFile(path)
+  if err != nil {
+    if os.IsNotExist(err) {
+      return fileConfig, nil
+    }
+    return nil, fmt.Errorf("cannot read %s: %s", path, err.Error())
+  }
+
+  err = yaml.Unmarshal(byt, fileConfig)
+  if err != nil {
+    return nil, fmt.Errorf("cannot parse %s: %s", path, err.Error())
+  }
+  return fileConfig, nil
+}
+
+/**
+ * Load the configuration file on top of the default configuration
+ */
+func LoadConfigFile(path string) (*ScrewdriverConfig, error) {
+  config, err := GetDefaultConfig()
+  if err != nil {
+    return nil, err
+  }
+
+  fileConfig, err := ReadConfigFile(path)
+  if err != nil {
+    return nil, err
+  }
+
+  // Override only the values present in the file. Paths can be relative
+  // to the home directory.
+  if fileConfig.UserBinDir != "" {
+    config.UserBinDir = ExpandHomeDir(fileConfig.UserBinDir)
+  }
+  if fileConfig.DataDir != "" {
+    config.DataDir = ExpandHomeDir(fileConfig.DataDir)
+  }
+  if fileConfig.Channel != "" {
+    if err := registry.CheckChannel(fileConfig.Channel); err != nil {
+      return nil, fmt.Errorf("%s: %s", path, err.Error())
+    }
+    config.Channel = fileConfig.Channel
+  }
+  if fileConfig.RegistryTTL != "" {
+    if _, err := ParseRegistryTTL(fileConfig.RegistryTTL); err != nil {
+      return nil, fmt.Errorf("%s: %s", path, err.Error())
+    }
+    config.RegistryTTL = fileConfig.RegistryTTL
+  }
+  if fileConfig.Offline {
+    config.Offline = true
+  }
+  if fileConfig.Registries != nil {
+    for _, reg := range fileConfig.Registries {
+      if err := checkRegistryName(reg.Name); err != nil {
+        return nil, fmt.Errorf("%s: %s", path, err.Error())
+      }
+    }
+    config.Registries = fileConfig.Registries
+  }
+
+  return config, nil
+}
+
+/**
+ * Change a key in the configuration file. Only the keys the user has set are
+ * written in the file, so the defaults still apply to the rest.
+ */
+func SetConfigFileValue(path string, key string, value string) error {
+  fileConfig, err := ReadConfigFile(path)
+  if err != nil {
+    return err
+  }
+
+  // The registries are written as a whole, starting from the default ones
+  if fileConfig.Registries == nil && strings.HasPrefix(key, "registries") {
+    defaults, err := GetDefaultConfig()
+    if err != nil {
+      return err
+    }
+    fileConfig.Registries = defaults.Registries
+  }
+
+  err = fileConfig.SetValue(key, value)
+  if err != nil {
+    return err
+  }
+  return SaveConfigFile(path, fileConfig)
+}
+
+/**
+ * Return the names of the registries that have no public key configured,
+ * even though they are not the default registry. These are verified with the
+ * pre-shared keys, which is most probably not what the user wants.
+ */
+func (config *ScrewdriverConfig) RegistriesWithoutKeys() []string {
+  var names []string
+  defaults, err := GetDefaultConfig()
+  if err != nil {
+    return nil
+  }
+
+  for _, reg := range config.Registries {
+    if reg.PubKey != "" {
+      continue
+    }
+    isDefault := false
+    for _, defaultReg := range defaults.Registries {
+      if reg.URL == defaultReg.URL {
+        isDefault = true
+      }
+    }
+    if !isDefault {
+      names = append(names, reg.Name)
+    }
+  }
+  return names
+}
+
+/**
+ * Save the configuration to the given file
+ */
+func SaveConfigFile(path string, config *ScrewdriverConfig) error {
+  byt, err := yaml.Marshal(config)
+  if err != nil {
+    return fmt.Errorf("cannot encode configuration: %s", err.Error())
+  }
+
+  err = os.MkdirAll(filepath.Dir(path), 0755)
+  if err != nil {
+    return fmt.Errorf("cannot create configuration directory: %s", err.Error())
+  }
+
+  return ioutil.WriteFile(path, byt, 0644)
+}
+
+/**
+ * Load the effective configuration: defaults, then the configuration file
+ * and finally the environment overrides
+ */
+func LoadConfig() (*ScrewdriverConfig, error) {
+  path, err := GetConfigFilePath()
+  if err != nil {
+    return nil, err
+  }
+
+  config, err := LoadConfigFile(path)
+  if err != nil {
+    return nil, err
+  }
+
+  err = config.ApplyEnvironment()
+  if err != nil {
+    return nil, err
+  }
+
+  return config, nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+  "fmt"
+  "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  "github.com/mesosphere/dcos-sonic-screwdriver/repository"
+  "strings"
+  . "github.com/logrusorgru/aurora"
+  . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
+)
+
+/**
+ * A tool version that has to be installed and linked before the tool that
+ * requires it
+ */
+type toolDependency struct {
+  Tool        *registry.RegistryTool
+  Version     *registry.ToolVersion
+  Artifact    *registry.ToolArtifact
+
+  // The requirement, and the tool that has it
+  Requirement registry.ToolRequirement
+  Dependent   string
+
+  // The installed version that satisfies the requirement, or nil if the
+  // version has to be installed
+  Installed   *repository.InstalledVersion
+}
+
+/**
+ * Return the version the dependency resolves to
+ */
+func (dep toolDependency) SemVer() SemVer {
+  if dep.Installed != nil {
+    return dep.Installed.Version
+  }
+  return dep.Version.Version
+}
+
+/**
+ * Resolve the tools the artifact depends on, transitively, in the order they
+ * have to be installed. Dependencies that are satisfied by an already
+ * installed version are not installed again, but they are still linked.
+ */
+func resolveDependencies(config *ScrewdriverConfig,
+  reg *registry.RegistrySet,
+  repo *repository.Repository,
+  toolInfo *registry.RegistryTool,
+  artifact *registry.ToolArtifact) ([]toolDependency, error) {
+
+  var plan []toolDependency = nil
+  chain := []string{repository.ToolKey(toolInfo.Registry, toolInfo.Name)}
+  err := resolveArtifactDependencies(config, reg, repo, chain, artifact, &plan)
+  return plan, err
+}
+
+/**
+ * Append the dependencies of the artifact to the plan, after their own
+ * dependencies. The chain contains the tools (as `registry/tool`) that lead
+ * to this artifact.
+ */
+func resolveArtifactDependencies(config *ScrewdriverConfig,
+  reg *registry.RegistrySet,
+  repo *repository.Repository,
+  chain []string,
+  artifact *registry.ToolArtifact,
+  plan *[]toolDependency) error {
+
+  for _, req := range artifact.ToolRequirements() {
+    dependent := chain[len(chain) - 1]
+    toolInfo, err := reg.FindTool(req.Tool)
+    if err != nil {
+      return fmt.Errorf("%s requires %s: %s", dependent, req.ToString(), err.Error())
+    }
+    tool := toolInfo.Name
+    toolKey := repository.ToolKey(toolInfo.Registry, tool)
+
+    // Tools can't depend on themselves, not even indirectly
+    for _, name := range chain {
+      if name == toolKey {
+        return fmt.Errorf("circular dependency %s", strings.Join(append(chain, toolKey), " -> "))
+      }
+    }
+
+    // The dependency might be already planned by another tool
+    constraint, err := ParseVersionConstraint(req.Version)
+    if err != nil {
+      return fmt.Errorf("%s requires %s: %s", dependent, req.ToString(), err.Error())
+    }
+    planned := false
+    for _, dep := range *plan {
+      if repository.ToolKey(dep.Tool.Registry, dep.Tool.Name) == toolKey {
+        if !constraint.Check(dep.SemVer()) {
+          return fmt.Errorf("%s requires %s, but %s/%s is required by another tool",
+            dependent, req.ToString(), toolKey, dep.SemVer().ToString())
+        }
+        planned = true
+      }
+    }
+    if planned {
+      continue
+    }
+
+    // Or it might be already installed, in which case it only needs a link
+    if toolRef, ok := repo.Tools[toolKey]; ok {
+      installedVer, err := toolRef.FindMatchingVersion(req.Version)
+      if err != nil {
+        return fmt.Errorf("%s requires %s: %s", dependent, req.ToString(), err.Error())
+      }
+      if installedVer != nil {
+        *plan = append(*plan, toolDependency{toolInfo, nil, nil, req, dependent, installedVer})
+        continue
+      }
+    }
+
+    version, err := toolInfo.Versions.Select(req.Version, config.Channel)
+    if err != nil {
+      return fmt.Errorf("%s requires %s: %s", dependent, req.ToString(), err.Error())
+    }
+    depArtifact, errors := repository.FindFirstRunableArtifact(version.Artifacts)
+    if depArtifact == nil {
+      var messages []string = nil
+      for _, artifactErrs := range errors {
+        messages = append(messages, strings.Join(artifactErrs, ", "))
+      }
+      return fmt.Errorf("%s requires %s, but no installable artifacts were found (%s)",
+        dependent, req.ToString(), strings.Join(messages, "; "))
+    }
+
+    // Its own dependencies go first
+    err = resolveArtifactDependencies(config, reg, repo, append(chain, toolKey), depArtifact, plan)
+    if err != nil {
+      return err
+    }
+    *plan = append(*plan, toolDependency{toolInfo, version, depArtifact, req, dependent, nil})
+  }
+
+  return nil
+}
+
+/**
+ * Install the tools the artifact depends on and make sure their shims run a
+ * version that satisfies the requirement, so the tool can find them in the
+ * path
+ */
+func installDependencies(config *ScrewdriverConfig,
+  reg *registry.RegistrySet,
+  repo *repository.Repository,
+  toolInfo *registry.RegistryTool,
+  artifact *registry.ToolArtifact) {
+
+  deps, err := resolveDependencies(config, reg, repo, toolInfo, artifact)
+  if err != nil {
+    die(err.Error())
+  }
+
+  for _, dep := range deps {
+    depTool := dep.Tool.Name
+    installedVer := dep.Installed
+    if installedVer == nil {
+      fmt.Printf("%s %s %s\n", Blue("==> "), Gray("Dependency of " + dep.Dependent + ":"),
+        Bold(Gray(depTool + "/" + dep.Version.ToString())))
+      printVersionWarning(depTool, dep.Version)
+
+      installedVer, err = repo.InstallToolVersion(dep.Tool.Registry, depTool, dep.Version, dep.Artifact)
+      if err != nil {
+        die(fmt.Sprintf("%s: %s", depTool, err.Error()))
+      }
+    }
+
+    if err := linkDependency(config, repo, dep, installedVer); err != nil {
+      die(err.Error())
+    }
+  }
+}
+
+/**
+ * Link the installed version of the dependency, unless the shim already runs
+ * a version of the same tool that satisfies the requirement. A shim of
+ * another version is switched over, while anything that ss doesn't manage,
+ * or a tool of another registry, is a conflict.
+ */
+func linkDependency(config *ScrewdriverConfig,
+  repo *repository.Repository,
+  dep toolDependency,
+  installedVer *repository.InstalledVersion) error {
+
+  depTool := dep.Tool.Name
+  target := ReadBinShim(config, depTool)
+  if target == "" {
+    return CreateBinShim(config, installedVer.GetExecutablePath(), depTool)
+  }
+
+  linkedTool, linkedVer := repo.FindToolFromLink(target)
+  if linkedTool == nil {
+    return fmt.Errorf("%s requires %s, but %s is not managed by ss",
+      dep.Dependent, dep.Requirement.ToString(), config.UserBinDir + "/" + depTool)
+  }
+  if linkedTool.Registry != dep.Tool.Registry {
+    return fmt.Errorf("%s requires %s, but %s links %s from registry '%s'",
+      dep.Dependent, dep.Requirement.ToString(), config.UserBinDir + "/" + depTool, depTool, linkedTool.Registry)
+  }
+
+  constraint, err := ParseVersionConstraint(dep.Requirement.Version)
+  if err != nil {
+    return fmt.Errorf("%s requires %s: %s", dep.Dependent, dep.Requirement.ToString(), err.Error())
+  }
+  if constraint.Check(linkedVer.Version) {
+    return nil
+  }
+
+  fmt.Printf("%s %s %s %s %s\n", Blue("==> "), Gray("Switching"), Bold(Gray(depTool)),
+    Gray("from " + linkedVer.Version.ToString() + " to " + installedVer.Version.ToString() + ", required by"),
+    Bold(Gray(dep.Dependent)))
+  return CreateBinShim(config, installedVer.GetExecutablePath(), depTool)
+}
+
+/**
+ * Find the installed tool versions that would be left without a version of
+ * the tool they depend on, if the given version (or all the versions, if nil)
+ * of the tool is removed
+ */
+func findBrokenDependents(repo *repository.Repository,
+  tool *repository.InstalledTool,
+  removed *SemVer) []string {
+
+  var dependents []string = nil
+  for _, toolRef := range repo.Tools {
+    if toolRef == tool {
+      continue
+    }
+    for _, ver := range toolRef.Versions {
+      if ver.Artifact == nil {
+        continue
+      }
+      artifact, err := ver.Artifact.GetRegistryArtifact()
+      if err != nil {
+        continue
+      }
+
+      for _, req := range artifact.ToolRequirements() {
+        reqRegistry, reqTool := registry.SplitToolName(req.Tool)
+        if reqTool != tool.Name || (reqRegistry != "" && reqRegistry != tool.Registry) {
+          continue
+        }
+        if !hasRemainingVersion(tool, removed, req.Version) {
+          dependents = append(dependents, toolRef.Name + "/" + ver.Version.ToString())
+        }
+      }
+    }
+  }
+
+  return dependents
+}
+
+/**
+ * Check if a version of the tool that satisfies the constraint is still
+ * installed, after removing the given version (or all, if nil)
+ */
+func hasRemainingVersion(toolRef *repository.InstalledTool,
+  removed *SemVer,
+  version string) bool {
+
+  if removed == nil {
+    return false
+  }
+  constraint, err := ParseVersionConstraint(version)
+  if err != nil {
+    return false
+  }
+  for _, ver := range toolRef.Versions {
+    if !ver.Version.Equals(*removed) && constraint.Check(ver.Version) {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Refuse to remove a tool other installed tools depend on, unless forced
+ */
+func checkDependents(repo *repository.Repository,
+  tool *repository.InstalledTool,
+  removed *SemVer,
+  force bool) {
+
+  dependents := findBrokenDependents(repo, tool, removed)
+  if len(dependents) == 0 {
+    return
+  }
+
+  fmt.Printf("%s %s is required by:\n", Red("Warning:"), tool.Name)
+  for _, dependent := range dependents {
+    fmt.Printf("  - %s\n", dependent)
+  }
+  if !force {
+    die("Not removing it. Use -f to remove it anyway.")
+  }
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+  "io/ioutil"
+  "os"
+  "testing"
+  "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  "github.com/mesosphere/dcos-sonic-screwdriver/repository"
+  . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
+)
+
+/**
+ * A registry with an `app` tool that requires the given tool, and a
+ * `kubectl` tool with a single 1.3.0 version
+ */
+func dependencyRegistry(t *testing.T, name string, require string) registry.NamedRegistry {
+  reg, err := registry.ParseRegistry([]byte(`{"version": 2, "tools": {
+    "app": {"versions": [{"version": "1.0.0", "artifacts": [{
+      "type": "executable", "platform": "*", "arch": "*",
+      "source": {"type": "file", "url": "https://example.com/app"},
+      "require": [` + require + `]
+    }]}]},
+    "kubectl": {"versions": [{"version": "1.3.0", "artifacts": [{
+      "type": "executable", "platform": "*", "arch": "*",
+      "source": {"type": "file", "url": "https://example.com/kubectl"}
+    }]}]}
+  }}`))
+  if err != nil {
+    t.Fatalf("invalid registry: %s", err.Error())
+  }
+  return registry.NamedRegistry{Name: name, Registry: reg}
+}
+
+/**
+ * Return the artifact of the `app` tool of the registry
+ */
+func appArtifact(t *testing.T, reg *registry.RegistrySet, name string) (*registry.RegistryTool, *registry.ToolArtifact) {
+  toolInfo, err := reg.FindTool(name)
+  if err != nil {
+    t.Fatalf("cannot find %s: %s", name, err.Error())
+  }
+  return toolInfo, &toolInfo.Versions[0].Artifacts[0]
+}
+
+/**
+ * An installed tool with the given versions, in folders under the base dir
+ */
+func installedTool(baseDir string, registryName string, tool string, versions ...string) *repository.InstalledTool {
+  toolRef := &repository.InstalledTool{Name: tool, Registry: registryName}
+  for _, version := range versions {
+    ver, _ := ParseSemVer(version)
+    toolRef.Versions = append(toolRef.Versions, repository.InstalledVersion{
+      Version: *ver,
+      Folder: baseDir + "/" + registryName + "/" + tool + "/" + version,
+    })
+  }
+  return toolRef
+}
+
+func TestInstallDependenciesSwitchesLinkedVersion(t *testing.T) {
+  dir, err := ioutil.TempDir("", "ss-deps")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  config := &ScrewdriverConfig{UserBinDir: dir, DataDir: dir}
+  kubectl := installedTool(dir, "default", "kubectl", "1.0.0", "1.3.0")
+  repo := &repository.Repository{
+    Sources: map[string]*repository.InstalledArtifact{},
+    Tools: map[string]*repository.InstalledTool{"default/kubectl": kubectl},
+    BaseDir: dir,
+  }
+  reg := &registry.RegistrySet{Registries: []registry.NamedRegistry{
+    dependencyRegistry(t, "default", `{"tool": "kubectl", "version": "^1.2"}`),
+  }}
+
+  // The user has the older version linked
+  if err := CreateBinShim(config, kubectl.Versions[0].GetExecutablePath(), "kubectl"); err != nil {
+    t.Fatal(err)
+  }
+
+  toolInfo, artifact := appArtifact(t, reg, "app")
+  installDependencies(config, reg, repo, toolInfo, artifact)
+
+  expected := kubectl.Versions[1].GetExecutablePath()
+  if target := ReadBinShim(config, "kubectl"); target != expected {
+    t.Errorf("expected kubectl to be linked to %s, got %s", expected, target)
+  }
+}
+
+func TestResolveDependenciesPerRegistry(t *testing.T) {
+  tests := []struct {
+    tool        string
+    require     string
+    installed   string
+    expected    string
+  }{
+    // A tool of another registry doesn't satisfy the requirement
+    {"a/app", `{"tool": "b/kubectl"}`, "a", "b"},
+    {"a/app", `{"tool": "kubectl"}`, "b", "a"},
+
+    // An installed version of the same registry only needs a link
+    {"a/app", `{"tool": "b/kubectl"}`, "b", "b (installed)"},
+
+    // The same name in another registry is not a cycle
+    {"a/app", `{"tool": "b/app"}`, "", "b"},
+  }
+
+  for _, test := range tests {
+    reg := &registry.RegistrySet{Registries: []registry.NamedRegistry{
+      dependencyRegistry(t, "a", test.require),
+      dependencyRegistry(t, "b", `{"cmd": "sh"}`),
+    }}
+    repo := &repository.Repository{Tools: map[string]*repository.InstalledTool{}}
+    if test.installed != "" {
+      repo.Tools[repository.ToolKey(test.installed, "kubectl")] = installedTool("/tmp", test.installed, "kubectl", "1.3.0")
+    }
+
+    toolInfo, artifact := appArtifact(t, reg, test.tool)
+    deps, err := resolveDependencies(&ScrewdriverConfig{Channel: registry.DefaultChannel}, reg, repo, toolInfo, artifact)
+    if err != nil {
+      t.Errorf("%s requiring %s: unexpected error: %s", test.tool, test.require, err.Error())
+      continue
+    }
+    if len(deps) != 1 {
+      t.Errorf("%s requiring %s: expected one dependency, got %d", test.tool, test.require, len(deps))
+      continue
+    }
+    actual := deps[0].Tool.Registry
+    if deps[0].Installed != nil {
+      actual += " (installed)"
+    }
+    if actual != test.expected {
+      t.Errorf("%s requiring %s: expected %s, got %s", test.tool, test.require, test.expected, actual)
+    }
+  }
+}
+
+func TestResolveDependenciesCycle(t *testing.T) {
+  reg := &registry.RegistrySet{Registries: []registry.NamedRegistry{
+    dependencyRegistry(t, "a", `{"tool": "a/app"}`),
+  }}
+  repo := &repository.Repository{Tools: map[string]*repository.InstalledTool{}}
+
+  toolInfo, artifact := appArtifact(t, reg, "a/app")
+  _, err := resolveDependencies(&ScrewdriverConfig{}, reg, repo, toolInfo, artifact)
+  if err == nil || err.Error() != "circular dependency a/app -> a/app" {
+    t.Errorf("expected a circular dependency, got %v", err)
+  }
+}
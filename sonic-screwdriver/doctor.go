@@ -0,0 +1,81 @@
+package main
+
+import (
+  "fmt"
+  "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  "github.com/mesosphere/dcos-sonic-screwdriver/repository"
+  "os"
+  . "github.com/logrusorgru/aurora"
+  . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
+)
+
+/**
+ * Check the integrity of the repository and optionally repair it
+ */
+func runDoctor(config *ScrewdriverConfig, fix bool) {
+
+  // The registry is only needed for repairing broken package states,
+  // so we can continue without it
+  var regs *registry.RegistrySet = nil
+  sources, err := config.RegistrySources()
+  if err == nil {
+    regs, err = registry.GetRegistrySet(config.DataDir, sources, config.FetchOptions())
+  }
+  if err != nil {
+    fmt.Printf("%s could not load the registry, some problems cannot be repaired: %s\n",
+      Red("Warning:"), err.Error())
+  }
+
+  // Collect problems
+  known := repository.IndexArtifacts(regs)
+  problems, err := repository.Diagnose(config.DataDir, config.UserBinDir, known)
+  if err != nil {
+    die(err.Error())
+  }
+  if len(problems) == 0 {
+    complete("Everything is in order!")
+  }
+
+  // Just report them if we are not fixing
+  if !fix {
+    fmt.Printf("Found %d problem(s):\n", len(problems))
+    for _, problem := range problems {
+      fmt.Printf(" %s %s %s\n", Bold(Red("●")), Bold(Gray(problem.Kind + ":")), problem.Message)
+    }
+    fmt.Println("")
+    fmt.Println("Use `ss -fix doctor` to repair them.")
+    os.Exit(1)
+  }
+
+  // Otherwise repair them while nobody else is using the repository. They
+  // are collected again, since another process might have changed it since.
+  lock, err := repository.LockRepository(config.DataDir, true)
+  if err != nil {
+    die(err.Error())
+  }
+  problems = repository.FindProblems(config.DataDir, config.UserBinDir, known)
+  if len(problems) == 0 {
+    lock.Unlock()
+    complete("Everything is in order!")
+  }
+
+  failed := 0
+  for _, problem := range problems {
+    fmt.Printf("%s %s %s\n", Bold(Blue("==> ")), Bold(Gray("Repair " + problem.Kind)), problem.Path)
+    if problem.Fix == nil {
+      fmt.Printf(" %s %s (cannot be repaired automatically)\n", Bold(Red("●")), problem.Message)
+      failed += 1
+      continue
+    }
+    if err := problem.Fix(); err != nil {
+      fmt.Printf(" %s %s\n", Bold(Red("●")), UcFirst(err.Error()))
+      failed += 1
+    }
+  }
+
+  lock.Unlock()
+  if failed > 0 {
+    die(fmt.Sprintf("%d problem(s) could not be repaired", failed))
+  }
+  complete(fmt.Sprintf("Repaired %d problem(s)", len(problems)))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+  "fmt"
+  "github.com/dustin/go-humanize"
+  "github.com/mesosphere/dcos-sonic-screwdriver/repository"
+  . "github.com/logrusorgru/aurora"
+)
+
+/**
+ * Remove the packages that are not used by any tool version
+ */
+func runGarbageCollection(config *ScrewdriverConfig, dryRun bool) {
+  garbage, err := repository.CollectGarbage(config.DataDir, dryRun)
+
+  var size uint64 = 0
+  for _, pkg := range garbage {
+    size += pkg.Size
+  }
+  if err != nil {
+    if len(garbage) > 0 {
+      fmt.Printf("Removed %d package(s), reclaiming %s\n", len(garbage), humanize.Bytes(size))
+    }
+    die(err.Error())
+  }
+  if len(garbage) == 0 {
+    complete("Nothing to clean-up")
+  }
+
+  // In dry-run mode, just show what would be removed
+  if dryRun {
+    fmt.Printf("Found %d unused package(s):\n", len(garbage))
+    for _, pkg := range garbage {
+      fmt.Printf(" %s %s %s\n", Bold(Red("●")), Bold(Gray(pkg.Artifact.ID)), humanize.Bytes(pkg.Size))
+      if pkg.Image != "" {
+        fmt.Printf("   and docker image %s\n", Bold(Gray(pkg.Image)))
+      }
+    }
+    fmt.Println("")
+    fmt.Printf("Running `ss gc` would reclaim %s\n", Bold(Gray(humanize.Bytes(size))))
+    return
+  }
+
+  complete(fmt.Sprintf("Removed %d package(s), reclaiming %s", len(garbage), humanize.Bytes(size)))
+}
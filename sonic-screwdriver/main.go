@@ -17,7 +17,7 @@ import (
   . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
 )
 
-var VERSION VersionTriplet = VersionTriplet{0,1,5}
+var VERSION SemVer = NewSemVer(0,1,5)
 var AlreadyUpgraded = errors.New("You already run the latest version")
 
 /**
@@ -41,20 +41,29 @@ func banner() {
 func help() {
   banner()
   fmt.Println("Typical usage:")
-  fmt.Println("  ss add [TOOL][:VERSION]")
+  fmt.Println("  ss add [REGISTRY/][TOOL][:VERSION | @CONSTRAINT]")
   fmt.Println("  ss rm [TOOL][:VERSION]")
   fmt.Println("  ss link [TOOL]")
   fmt.Println("  ss unlink [TOOL]")
+  fmt.Println("  ss install")
+  fmt.Println("  ss run [TOOL][:VERSION] -- [ARGS...]")
   fmt.Println("")
   fmt.Println("Discovery:")
   fmt.Println("  ss ls [TOPIC | NAME | REGEX]")
   fmt.Println("  ss help [TOOL]")
-  fmt.Println("  ss info [TOOL]")
+  fmt.Println("  ss info [TOOL] [--filter CONSTRAINT]")
   fmt.Println("")
   fmt.Println("Management commands:")
   fmt.Println("  ss update")
   fmt.Println("  ss upgrade")
+  fmt.Println("  ss config list")
+  fmt.Println("  ss config get [KEY]")
+  fmt.Println("  ss config set [KEY] [VALUE]")
   fmt.Println("  ss version")
+  fmt.Println("  ss [-fix] doctor")
+  fmt.Println("  ss [-n] gc")
+  fmt.Println("")
+  fmt.Println("Use `ss -offline [COMMAND]` to only use the cached registries.")
   fmt.Println("")
   os.Exit(2)
 }
@@ -84,21 +93,39 @@ func widePad(msg string) string {
 }
 
 /**
- * Load the registry  pair and exit on errors
+ * Get the configured registry sources and exit on errors
  */
-func getRegistry(config *ScrewdriverConfig) *registry.Registry {
-  // Load registry (could be slower)
+func getRegistrySources(config *ScrewdriverConfig) []registry.RegistrySource {
+  sources, err := config.RegistrySources()
+  if err != nil {
+    die(err.Error())
+  }
+  if len(sources) == 0 {
+    die("No registries are configured, try `ss config set registries default`")
+  }
+  return sources
+}
+
+/**
+ * Load the configured registries and exit on errors
+ */
+func getRegistry(config *ScrewdriverConfig) *registry.RegistrySet {
+  // Load registries (could be slower)
   spinner := spinner.New(spinner.CharSets[13], 100*time.Millisecond)
   spinner.Start()
-  reg, err := registry.GetRegistry(
+  reg, err := registry.GetRegistrySet(
     config.DataDir,
-    config.RegistryURL,
-    config.RegistryPubKey)
+    getRegistrySources(config),
+    config.FetchOptions())
   if err != nil {
     spinner.Stop()
     die(err.Error())
   }
   spinner.Stop()
+  for _, stale := range reg.Stale {
+    fmt.Printf("%s could not refresh registry '%s' (%s), using the copy verified %s\n",
+      Red("Warning:"), stale.Name, stale.Err.Error(), humanize.Time(stale.CachedAt))
+  }
   checkMinToolVersion(reg)
 
   return reg
@@ -107,7 +134,7 @@ func getRegistry(config *ScrewdriverConfig) *registry.Registry {
 /**
  * Load the registry + repository pair and exit on errors
  */
-func getRegistryRepository(config *ScrewdriverConfig) (*registry.Registry, *repository.Repository) {
+func getRegistryRepository(config *ScrewdriverConfig) (*registry.RegistrySet, *repository.Repository) {
   // Load repository (should be fast)
   repo, err := repository.LoadRepository(config.DataDir)
   if err != nil {
@@ -117,6 +144,12 @@ func getRegistryRepository(config *ScrewdriverConfig) (*registry.Registry, *repo
   // Load registry (could be slower)
   reg := getRegistry(config)
 
+  // Migrate the tools that were installed by 0.1.1
+  err = repo.MigrateLegacyVersions(reg, config.UserBinDir)
+  if err != nil {
+    die(err.Error())
+  }
+
   // Return tuple
   return reg, repo
 }
@@ -124,10 +157,24 @@ func getRegistryRepository(config *ScrewdriverConfig) (*registry.Registry, *repo
 /**
  * Perform a fully automated tool upgrade
  */
-func upgradeTool() error {
+func upgradeTool(config *ScrewdriverConfig) error {
+  // Releases are signed with the pre-shared keys, or the ones that
+  // replaced them through the registries' key rotations
+  keys, err := GetHardCodedKeyring()
+  if err != nil {
+    return err
+  }
+  for _, reg := range config.Registries {
+    source := registry.RegistrySource{Name: reg.Name, URL: reg.URL}
+    keys, err = source.RotatedKeys(config.DataDir, keys)
+    if err != nil {
+      return fmt.Errorf("registry '%s': %s", reg.Name, err.Error())
+    }
+  }
+
   spinner := spinner.New(spinner.CharSets[13], 100*time.Millisecond)
   spinner.Start()
-  lastVersion, err := GetLatestVersion()
+  lastVersion, err := GetLatestVersion(keys)
   if err != nil {
     spinner.Stop()
     return err
@@ -135,7 +182,7 @@ func upgradeTool() error {
   spinner.Stop()
 
   // Check if there is a new version to upgrade
-  if lastVersion.Version.GraterThan(&VERSION) {
+  if lastVersion.Version.GreaterThan(&VERSION) {
     fmt.Printf("%s %s from %s -> to %s\n",
       Magenta("==>"),
       Bold(Gray("Upgrading")),
@@ -143,7 +190,7 @@ func upgradeTool() error {
       lastVersion.Version.ToString())
 
     // Perform upgrade and check for errors
-    err := PerformUpgrade(lastVersion)
+    err = PerformUpgrade(lastVersion)
     if err != nil {
       return err
     } else {
@@ -156,11 +203,82 @@ func upgradeTool() error {
 }
 
 /**
- * Check if the registry is targeting a newer tool version
+ * Check if any of the registries is targeting a newer tool version
  */
-func checkMinToolVersion(reg *registry.Registry) {
-  if reg.ToolVersion.GraterThan(&VERSION) {
-    die("👴🏻  Your tool is outdated, try `ss upgrade` to get the latest version.")
+func checkMinToolVersion(regs *registry.RegistrySet) {
+  for _, reg := range regs.Registries {
+    if reg.ToolVersion.GreaterThan(&VERSION) {
+      die("👴🏻  Your tool is outdated, try `ss upgrade` to get the latest version.")
+    }
+  }
+}
+
+/**
+ * Handle the `config` sub-commands
+ */
+func manageConfig(config *ScrewdriverConfig, args []string) {
+  if len(args) < 1 {
+    fmt.Println("Missing config action")
+    help()
+  }
+
+  switch args[0] {
+    case "ls", "list":
+      for _, key := range config.Keys() {
+        value, _ := config.GetValue(key)
+        fmt.Printf("%s%s\n", Bold(Gray(widePad(" "+key))), value)
+      }
+
+    case "get":
+      if len(args) < 2 {
+        fmt.Println("Missing configuration key")
+        help()
+      }
+      value, err := config.GetValue(args[1])
+      if err != nil {
+        die(err.Error())
+      }
+      fmt.Println(value)
+
+    case "set":
+      if len(args) < 3 {
+        fmt.Println("Missing configuration key or value")
+        help()
+      }
+
+      // Change the configuration file only, without the environment overrides
+      path, err := GetConfigFilePath()
+      if err != nil {
+        die(err.Error())
+      }
+      err = SetConfigFileValue(path, args[1], args[2])
+      if err != nil {
+        die(err.Error())
+      }
+
+      // Warn if a registry is going to be verified with the keys of the
+      // default registry
+      if strings.HasPrefix(args[1], "registries") {
+        fileConfig, err := LoadConfigFile(path)
+        if err != nil {
+          die(err.Error())
+        }
+        for _, name := range fileConfig.RegistriesWithoutKeys() {
+          fmt.Printf("%s registry '%s' has no public key, so it's verified with the keys of the default registry (use `ss config set registries.%s.pubKey`)\n",
+            Red("Warning:"), name, name)
+        }
+      }
+
+      // Warn if the environment is going to override this value
+      if os.Getenv(ConfigKeyEnvName(args[1])) != "" {
+        fmt.Printf("%s %s is overridden by %s\n",
+          Red("Warning:"), args[1], ConfigKeyEnvName(args[1]))
+      }
+      complete(fmt.Sprintf("%s updated in %s", args[1], path))
+
+    default:
+      fmt.Printf("Unknown config action '%s'\n", args[0])
+      help()
   }
 }
 
@@ -181,24 +299,82 @@ func printArtifactErrors(errors [][]string) {
   }
 }
 
+/**
+ * Find the installed version to link in offline mode, since we can't
+ * download a new one
+ */
+func findOfflineVersion(repo *repository.Repository,
+  toolInfo *registry.RegistryTool,
+  version string) *registry.ToolVersion {
+
+  if toolRef, ok := repo.Tools[repository.ToolKey(toolInfo.Registry, toolInfo.Name)]; ok {
+    installedVer, err := toolRef.FindMatchingVersion(version)
+    if err != nil {
+      die(fmt.Sprintf("%s: %s", toolInfo.Name, err.Error()))
+    }
+    if installedVer != nil {
+      if found := toolInfo.Versions.Get(installedVer.Version); found != nil {
+        return found
+      }
+    }
+  }
+
+  die(fmt.Sprintf("%s: no matching version is installed, and we can't download one in offline mode",
+    toolInfo.Name))
+  return nil
+}
+
+/**
+ * Check if the shim of the tool runs another installed tool, such as the
+ * tool with the same name from another registry
+ */
+func isShimOfOtherTool(config *ScrewdriverConfig,
+  repo *repository.Repository,
+  tool string,
+  toolRef *repository.InstalledTool) bool {
+
+  target := ReadBinShim(config, tool)
+  if target == "" {
+    return false
+  }
+  linkedTool, _ := repo.FindToolFromLink(target)
+  return linkedTool != nil && linkedTool != toolRef
+}
+
+/**
+ * Warn the user if the version is deprecated or yanked
+ */
+func printVersionWarning(tool string, version *registry.ToolVersion) {
+  if warning := version.Warning(); warning != "" {
+    fmt.Printf("%s %s/%s is %s\n", Red("Warning:"), tool, version.ToString(), warning)
+  }
+}
+
 /**
  * Entry point
  */
 func main() {
-  var toolInfo registry.ToolInfo
-  var ok bool
+  var toolInfo *registry.RegistryTool
 
   fVersion := flag.String("v", "", "The tool version to use")
-  fForce := flag.Bool("f", false, "Force overwriting symlinks not created by us")
+  fForce := flag.Bool("f", false, "Force overwriting tools not created by us")
+  fFix := flag.Bool("fix", false, "Repair the problems found by `doctor`")
+  fDryRun := flag.Bool("n", false, "Only show what `gc` would remove")
+  fFilter := flag.String("filter", "", "Only show the versions matching a version constraint")
+  fOffline := flag.Bool("offline", false, "Never touch the network, only use the cached registries")
   flag.Parse()
   if flag.NArg() < 1 {
     help()
   }
 
-  config, err := GetDefaultConfig()
+  config, err := LoadConfig()
   if err != nil {
     die(err.Error())
   }
+  if *fOffline {
+    config.Offline = true
+  }
+  Offline = config.Offline
 
   // Check actions
   switch flag.Arg(0) {
@@ -242,7 +418,7 @@ func main() {
     ///
     /// Install a new tool
     ///
-    case "a", "add", "install":
+    case "a", "add":
       if flag.NArg() < 2 {
         fmt.Println("Missing tool name")
         help()
@@ -253,23 +429,25 @@ func main() {
 
       // Lookup tool and separate version
       tool, tVersion := SplitVersion(flag.Arg(1))
-      if toolInfo, ok = reg.Tools[tool]; !ok {
-        die(fmt.Sprintf("🥔  Could not find tool '%s', here is a potato...", tool))
+      if toolInfo, err = reg.FindTool(tool); err != nil {
+        die(fmt.Sprintf("🥔  %s, here is a potato...", UcFirst(err.Error())))
       }
+      tool = toolInfo.Name
 
       // Lookup version
       var version *registry.ToolVersion = nil
       if *fVersion != "" {
         tVersion = *fVersion
       }
-      if tVersion != "" {
-        version, err = toolInfo.Versions.Find(tVersion)
+      if config.Offline {
+        version = findOfflineVersion(repo, toolInfo, tVersion)
+      } else {
+        version, err = toolInfo.Versions.Select(tVersion, config.Channel)
         if err != nil {
           die(fmt.Sprintf("%s: %s (use `info %s` to list available versions)", tool, err.Error(), tool))
         }
-      } else {
-        version = toolInfo.Versions.Latest()
       }
+      printVersionWarning(tool, version)
 
       // Find the first artifact that can be executed on our current system
       // configuration (CPU architecture, installed interpreters or docker)
@@ -281,10 +459,7 @@ func main() {
       }
 
       // Check if there is already a symlink for this tool
-      symlinkTarget, err := ReadBinSymlink(config, tool)
-      if err != nil {
-        die(fmt.Sprintf("%s: %s", tool, err.Error()))
-      }
+      symlinkTarget := ReadBinShim(config, tool)
 
       // Check if we have a tool already installed on this symlink
       if symlinkTarget != "" {
@@ -294,21 +469,21 @@ func main() {
         // symlink target, we are most probably going to touch something that
         // does not belong to us... warn the user
         if symlinkedTool == nil {
-          if HasBinSymlink(config, tool) && !*fForce {
+          if HasBinShim(config, tool) && !*fForce {
             die("There is already a tool with the same name in your path. Not installing.")
           }
         } else {
 
           // If the linked version is desired version, we are good
-          if symlinkedVersion.Version.Equals(version.Version) {
+          if symlinkedTool.Registry == toolInfo.Registry && symlinkedVersion.Version.Equals(version.Version) {
             complete(fmt.Sprintf("%s/%s is already there!", tool, version.ToString()))
           }
 
           // Check if we have the target version already installed, and if
           // we have it, switch link target to the installed version
-          targetVersion := repo.FindToolVersion(tool, version.Version)
+          targetVersion := repo.FindToolVersion(toolInfo.Registry, tool, version.Version)
           if targetVersion != nil {
-            err = CreateBinSymlink(config, targetVersion.GetExecutablePath(), tool)
+            err = CreateBinShim(config, targetVersion.GetExecutablePath(), tool)
             if err != nil {
               die(fmt.Sprintf("%s: %s", tool, err.Error()))
             }
@@ -317,20 +492,44 @@ func main() {
         }
       }
 
-      // Download the archive
-      installedVer, err := repo.InstallToolVersion(tool, version, artifact)
+      // Download the archive, after the tools it depends on
+      fmt.Printf("%s %s %s\n", Blue("==> "), Gray("Using registry"), Bold(Gray(toolInfo.Registry)))
+      installDependencies(config, reg, repo, toolInfo, artifact)
+      installedVer, err := repo.InstallToolVersion(toolInfo.Registry, tool, version, artifact)
       if err != nil {
         die(fmt.Sprintf("%s: %s", tool, err.Error()))
       }
 
       // Install symbolic link
-      err = CreateBinSymlink(config, installedVer.GetExecutablePath(), tool)
+      err = CreateBinShim(config, installedVer.GetExecutablePath(), tool)
       if err != nil {
         die(fmt.Sprintf("%s: %s", tool, err.Error()))
       }
 
       complete(fmt.Sprintf("%s/%s has landed!", tool, version.ToString()))
 
+    ///
+    /// Install the tools required by the project manifest
+    ///
+    case "install":
+      installManifest(config, *fForce)
+
+    ///
+    /// Run a tool version without linking it
+    ///
+    case "run":
+      if flag.NArg() < 2 {
+        fmt.Println("Missing tool name")
+        help()
+      }
+      runTool(config, flag.Arg(1), *fVersion, flag.Args()[2:])
+
+    ///
+    /// Run the tool version required by the project (used by the shims)
+    ///
+    case "shim":
+      runShim(config, flag.Args()[1:])
+
     ///
     /// Remove an existing tool
     ///
@@ -346,10 +545,16 @@ func main() {
         die(err.Error())
       }
 
-      // Check if we have neither a symlink, nor a tool
-      tool, tVersion := SplitVersion(flag.Arg(1))
-      if !repo.IsToolInstalled(tool) && !HasBinSymlink(config, tool) {
-        complete(fmt.Sprintf("%s is not installed", tool))
+      // Check if we have neither a symlink, nor a tool. The tool can be
+      // qualified with the registry it was installed from.
+      toolArg, tVersion := SplitVersion(flag.Arg(1))
+      _, tool := registry.SplitToolName(toolArg)
+      toolRef, err := repo.FindInstalledTool(toolArg)
+      if err != nil {
+        die(err.Error())
+      }
+      if toolRef == nil && !HasBinShim(config, tool) {
+        complete(fmt.Sprintf("%s is not installed", toolArg))
       }
 
       // If the user has not requested the removal of a specific version,
@@ -358,16 +563,25 @@ func main() {
         tVersion = *fVersion
       }
       if tVersion == "" {
+        if toolRef != nil {
+          checkDependents(repo, toolRef, nil, *fForce)
+        }
 
-        // If we have a tray symlink, remove it
-        if HasBinSymlink(config, tool) {
-          RemoveBinSymlink(config, tool)
+        // If we have a tray symlink, remove it, unless it belongs to the
+        // tool of another registry
+        if HasBinShim(config, tool) && !isShimOfOtherTool(config, repo, tool, toolRef) {
+          RemoveBinShim(config, tool)
         }
 
-        // Remove all tool versions
-        if toolRef, ok := repo.Tools[tool]; ok {
-          for _, versionRef := range toolRef.Versions {
-            repo.UninstallToolVersion(toolRef, &versionRef)
+        // Remove all tool versions, walking a copy since every uninstall
+        // removes the version from the tool
+        if toolRef != nil {
+          versions := append([]repository.InstalledVersion{}, toolRef.Versions...)
+          for _, versionRef := range versions {
+            err := repo.UninstallToolVersion(toolRef, &versionRef)
+            if err != nil {
+              die(err.Error())
+            }
           }
 
           // Remove the tool itself
@@ -377,33 +591,34 @@ func main() {
           }
         }
 
-        complete(fmt.Sprintf("%s has left the rocket ship!", tool))
+        complete(fmt.Sprintf("%s has left the rocket ship!", toolArg))
 
 
       // Otherwise remove the specific version
       } else {
 
         // Parse version
-        verTriplet, err := VersionFromString(tVersion)
+        verTriplet, err := ParseSemVer(tVersion)
         if err != nil {
           die(fmt.Sprintf("invalid version: %s", tVersion))
         }
 
         // Check if there is already a symlink for this tool
-        symlinkTarget, err := ReadBinSymlink(config, tool)
-        if err != nil {
-          die(fmt.Sprintf("%s: %s", tool, err.Error()))
-        }
+        symlinkTarget := ReadBinShim(config, tool)
 
         // Walk versions and find the matching one
-        if toolRef, ok := repo.Tools[tool]; ok {
+        if toolRef != nil {
           for _, versionRef := range toolRef.Versions {
             if versionRef.Version.Equals(*verTriplet) {
-              repo.UninstallToolVersion(toolRef, &versionRef)
+              checkDependents(repo, toolRef, verTriplet, *fForce)
+              err := repo.UninstallToolVersion(toolRef, &versionRef)
+              if err != nil {
+                die(err.Error())
+              }
 
               // If this version is the linked one, remove it
               if symlinkTarget == versionRef.GetExecutablePath() {
-                RemoveBinSymlink(config, tool)
+                RemoveBinShim(config, tool)
               }
 
               // Check if this was the last version
@@ -415,12 +630,12 @@ func main() {
                 }
               }
 
-              complete(fmt.Sprintf("%s has left the rocket ship!", tool))
+              complete(fmt.Sprintf("%s has left the rocket ship!", toolArg))
             }
           }
         }
 
-        die(fmt.Sprintf("Unable to find version %s/%s", tool, tVersion))
+        die(fmt.Sprintf("Unable to find version %s/%s", toolArg, tVersion))
       }
 
 
@@ -435,8 +650,8 @@ func main() {
 
       // Remove symbolic link
       tool := flag.Arg(1)
-      if HasBinSymlink(config, tool) {
-        RemoveBinSymlink(config, tool)
+      if HasBinShim(config, tool) {
+        RemoveBinShim(config, tool)
       } else {
         complete(fmt.Sprintf("%s is not linked (or installed)", tool))
       }
@@ -451,7 +666,8 @@ func main() {
 
       // Sort names
       var keys []string
-      for tool, _ := range reg.Tools {
+      tools := reg.Tools()
+      for tool, _ := range tools {
         keys = append(keys, tool)
       }
       sort.Strings(keys)
@@ -461,11 +677,24 @@ func main() {
       for _, tool := range keys {
 
         suffix := ""
-        if repo.IsToolInstalled(tool) {
+        if repo.IsToolInstalled(tools[tool].Registry, tools[tool].Name) {
           suffix = " *"
         }
 
-        fmt.Printf("%s%s\n", Bold(Gray(widePad(" "+tool+suffix))), reg.Tools[tool].Desc)
+        fmt.Printf("%s%s %s\n",
+          Bold(Gray(widePad(" "+tool+suffix))),
+          tools[tool].Desc,
+          Gray("["+tools[tool].Registry+"]"))
+
+        // Flag the installed versions that were deprecated or yanked since
+        if toolRef, ok := repo.Tools[repository.ToolKey(tools[tool].Registry, tools[tool].Name)]; ok {
+          for _, installedVer := range toolRef.Versions {
+            ver := tools[tool].Versions.Get(installedVer.Version)
+            if ver != nil && ver.Warning() != "" {
+              fmt.Printf("%s%s\n", widePad(""), Red(fmt.Sprintf("! %s is %s", ver.ToString(), ver.Warning())))
+            }
+          }
+        }
       }
 
     ///
@@ -477,25 +706,54 @@ func main() {
         help()
       }
 
+      // The flags can also follow the tool (eg. `ss info tool --filter ^1.4`)
+      tool, tVersion := SplitVersion(flag.Arg(1))
+      flag.CommandLine.Parse(flag.Args()[2:])
+      if *fFilter != "" {
+        tVersion = *fFilter
+      }
+
+      // Parse the version filter
+      var filter *VersionConstraint = nil
+      if tVersion != "" {
+        if filter, err = ParseVersionConstraint(tVersion); err != nil {
+          die(err.Error())
+        }
+      }
+
       // Load registry and repository
       reg, repo := getRegistryRepository(config)
 
       // Lookup tool
-      tool := flag.Arg(1)
-      if toolInfo, ok = reg.Tools[tool]; !ok {
-        die(fmt.Sprintf("🥔  Could not find tool '%s', here is a potato...", tool))
+      if toolInfo, err = reg.FindTool(tool); err != nil {
+        die(fmt.Sprintf("🥔  %s, here is a potato...", UcFirst(err.Error())))
       }
+      tool = toolInfo.Name
 
       // List versions
-      fmt.Printf("Available versions for '%s':\n", tool)
+      if filter != nil {
+        fmt.Printf("Available versions for '%s' in registry '%s' matching '%s':\n",
+          tool, toolInfo.Registry, filter.ToString())
+      } else {
+        fmt.Printf("Available versions for '%s' in registry '%s':\n", tool, toolInfo.Registry)
+      }
       for _, ver := range toolInfo.Versions {
+        if filter != nil && !filter.Check(ver.Version) {
+          continue
+        }
 
         suffix := ""
-        installedTool := repo.FindToolVersion(tool, ver.Version)
+        if ver.GetChannel() != registry.DefaultChannel {
+          suffix += " [" + ver.GetChannel() + "]"
+        }
+        installedTool := repo.FindToolVersion(toolInfo.Registry, tool, ver.Version)
         if installedTool != nil {
-          suffix = " (installed)"
+          suffix += " (installed)"
         }
         fmt.Printf("  * %s %s\n", Bold(Gray(ver.ToString())), suffix)
+        if warning := ver.Warning(); warning != "" {
+          fmt.Printf("    %s\n", Red("! "+UcFirst(warning)))
+        }
 
         if installedTool != nil {
           verSize, err := installedTool.Size()
@@ -545,10 +803,10 @@ func main() {
       reg := getRegistry(config)
 
       // Lookup tool
-      tool := flag.Arg(1)
-      if toolInfo, ok = reg.Tools[tool]; !ok {
-        die(fmt.Sprintf("🥔  Could not find tool '%s', here is a potato...", tool))
+      if toolInfo, err = reg.FindTool(flag.Arg(1)); err != nil {
+        die(fmt.Sprintf("🥔  %s, here is a potato...", UcFirst(err.Error())))
       }
+      tool := toolInfo.Name
 
       // Handle help
       if toolInfo.Help.ToolHelpText != nil {
@@ -561,7 +819,9 @@ func main() {
         }
         return
       } else if toolInfo.Help.ToolHelpURL != nil {
-        if toolInfo.Help.Inline {
+        if config.Offline {
+          fmt.Printf("The help of %s is available at %s\n", tool, toolInfo.Help.URL)
+        } else if toolInfo.Help.Inline {
           fmt.Printf("--=[ %s ]=--\n", Bold(Gray(tool)))
           contents, err := DownloadHelpText(toolInfo.Help.URL)
           if err != nil {
@@ -585,7 +845,7 @@ func main() {
     /// Update the tool
     ///
     case "upgrade":
-      err := upgradeTool()
+      err := upgradeTool(config)
       if err == AlreadyUpgraded {
         complete(err.Error())
       } else if err != nil {
@@ -597,15 +857,33 @@ func main() {
     ///
     case "update":
       fmt.Printf("Updating registry...\n")
-      _, err := registry.UpdateRegistry(
+      _, err := registry.UpdateRegistrySet(
         config.DataDir,
-        config.RegistryURL,
-        config.RegistryPubKey)
+        getRegistrySources(config),
+        config.FetchOptions())
       if err != nil {
         die(err.Error())
       }
       complete("Registry is updated")
 
+    ///
+    /// Check (and repair) the integrity of the repository
+    ///
+    case "doctor", "verify":
+      runDoctor(config, *fFix)
+
+    ///
+    /// Remove the packages that are not used any more
+    ///
+    case "gc":
+      runGarbageCollection(config, *fDryRun)
+
+    ///
+    /// Inspect or change the configuration
+    ///
+    case "config":
+      manageConfig(config, flag.Args()[1:])
+
     ///
     /// Show the version
     ///
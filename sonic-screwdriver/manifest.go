@@ -0,0 +1,103 @@
+package main
+
+import (
+  "bufio"
+  "fmt"
+  "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+/**
+ * The name of the project manifest file
+ */
+const ManifestFileName = ".ss-tools"
+
+/**
+ * A tool version required by the project
+ */
+type ManifestEntry struct {
+  Tool        string
+  Version     string
+  Line        int
+}
+
+/**
+ * The tools required by a project, as listed in it's `.ss-tools` file
+ */
+type Manifest struct {
+  Path        string
+  Entries     []ManifestEntry
+}
+
+/**
+ * Parse a manifest file. Every line contains a `tool:version` pair, while
+ * empty lines and lines starting with `#` are ignored.
+ */
+func ParseManifest(path string) (*Manifest, error) {
+  file, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  manifest := &Manifest{path, nil}
+  scanner := bufio.NewScanner(file)
+  lineNo := 0
+  for scanner.Scan() {
+    lineNo += 1
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+
+    tool, version := SplitVersion(line)
+    if tool == "" || version == "" {
+      return nil, fmt.Errorf("%s:%d: expecting `tool:version` or `tool@constraint`", path, lineNo)
+    }
+    manifest.Entries = append(manifest.Entries, ManifestEntry{tool, version, lineNo})
+  }
+  if err := scanner.Err(); err != nil {
+    return nil, fmt.Errorf("could not read %s: %s", path, err.Error())
+  }
+
+  return manifest, nil
+}
+
+/**
+ * Find the manifest of the project, by walking up from the given directory.
+ * Returns `nil` if there is no manifest.
+ */
+func FindManifest(dir string) (*Manifest, error) {
+  dir, err := filepath.Abs(dir)
+  if err != nil {
+    return nil, err
+  }
+
+  for {
+    path := filepath.Join(dir, ManifestFileName)
+    if _, err := os.Stat(path); err == nil {
+      return ParseManifest(path)
+    }
+
+    parent := filepath.Dir(dir)
+    if parent == dir {
+      return nil, nil
+    }
+    dir = parent
+  }
+}
+
+/**
+ * Find the version of the given tool required by the manifest, that might be
+ * qualified with the name of it's registry (eg. `default/tool:1.0`)
+ */
+func (m *Manifest) Find(tool string) *ManifestEntry {
+  for idx, entry := range m.Entries {
+    if _, name := registry.SplitToolName(entry.Tool); name == tool {
+      return &m.Entries[idx]
+    }
+  }
+  return nil
+}
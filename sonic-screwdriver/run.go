@@ -0,0 +1,119 @@
+package main
+
+import (
+  "fmt"
+  "github.com/mesosphere/dcos-sonic-screwdriver/registry"
+  "github.com/mesosphere/dcos-sonic-screwdriver/repository"
+  "os"
+  "syscall"
+  . "github.com/logrusorgru/aurora"
+)
+
+/**
+ * Find the installed version of the tool to run, or the latest one installed
+ * if no version is given
+ */
+func findRunVersion(repo *repository.Repository, tool string, version string) (*repository.InstalledVersion, error) {
+  toolRef, err := repo.FindInstalledTool(tool)
+  if toolRef == nil || err != nil {
+    return nil, err
+  }
+  if version != "" {
+    return toolRef.FindMatchingVersion(version)
+  }
+
+  var found *repository.InstalledVersion = nil
+  for idx, ver := range toolRef.Versions {
+    if found == nil || ver.Version.GreaterThan(&found.Version) {
+      found = &toolRef.Versions[idx]
+    }
+  }
+  return found, nil
+}
+
+/**
+ * Install the given tool version without linking it
+ */
+func installRunVersion(config *ScrewdriverConfig,
+  repo *repository.Repository,
+  tool string,
+  version string) *repository.InstalledVersion {
+
+  reg := getRegistry(config)
+  toolInfo, err := reg.FindTool(tool)
+  if err != nil {
+    die(fmt.Sprintf("🥔  %s, here is a potato...", err.Error()))
+  }
+
+  toolVersion, err := toolInfo.Versions.Select(version, config.Channel)
+  if err != nil {
+    die(fmt.Sprintf("%s: %s (use `info %s` to list available versions)", tool, err.Error(), tool))
+  }
+  printVersionWarning(tool, toolVersion)
+
+  artifact, errors := repository.FindFirstRunableArtifact(toolVersion.Artifacts)
+  if artifact == nil {
+    fmt.Printf("%s %s: no installable artifacts found. I tried:\n", Red("Error:"), tool)
+    printArtifactErrors(errors)
+    os.Exit(1)
+  }
+
+  // Download the archive, after the tools it depends on
+  fmt.Printf("%s %s %s\n", Blue("==> "), Gray("Using registry"), Bold(Gray(toolInfo.Registry)))
+  installDependencies(config, reg, repo, toolInfo, artifact)
+  installedVer, err := repo.InstallToolVersion(toolInfo.Registry, toolInfo.Name, toolVersion, artifact)
+  if err != nil {
+    die(fmt.Sprintf("%s: %s", tool, err.Error()))
+  }
+
+  return installedVer
+}
+
+/**
+ * Run a tool version, installing it if it's missing, without touching the
+ * tool in the user bin directory
+ */
+func runTool(config *ScrewdriverConfig, toolVersion string, version string, args []string) {
+  tool, tVersion := SplitVersion(toolVersion)
+  if version != "" {
+    tVersion = version
+  }
+
+  // Everything after `--` is passed to the tool as-is
+  if len(args) > 0 && args[0] == "--" {
+    args = args[1:]
+  }
+
+  // Use the version required by the project, if not given
+  _, name := registry.SplitToolName(tool)
+  if tVersion == "" {
+    manifest, err := findProjectManifest()
+    if err != nil {
+      die(err.Error())
+    }
+    if manifest != nil {
+      if entry := manifest.Find(name); entry != nil {
+        tVersion = entry.Version
+      }
+    }
+  }
+
+  repo, err := repository.LoadRepository(config.DataDir)
+  if err != nil {
+    die(err.Error())
+  }
+
+  // Unqualified names are matching the installed tool of any registry
+  installedVer, err := findRunVersion(repo, tool, tVersion)
+  if err != nil {
+    die(fmt.Sprintf("%s: %s", tool, err.Error()))
+  }
+  if installedVer == nil {
+    installedVer = installRunVersion(config, repo, tool, tVersion)
+  }
+
+  // Replace our process with the tool, so the standard I/O, the terminal
+  // and the exit code are the ones of the tool
+  err = syscall.Exec(installedVer.GetExecutablePath(), append([]string{name}, args...), os.Environ())
+  die(fmt.Sprintf("%s: %s", tool, err.Error()))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+  "fmt"
+  "github.com/mesosphere/dcos-sonic-screwdriver/repository"
+  "os"
+  "syscall"
+  . "github.com/logrusorgru/aurora"
+)
+
+/**
+ * Find the project manifest, starting from the current directory
+ */
+func findProjectManifest() (*Manifest, error) {
+  cwd, err := os.Getwd()
+  if err != nil {
+    return nil, err
+  }
+  return FindManifest(cwd)
+}
+
+/**
+ * Run the tool version required by the project manifest, or the default
+ * target of the shim if the project does not require a specific version.
+ * This is called by the shims with `ss shim TOOL TARGET [ARGS...]`.
+ */
+func runShim(config *ScrewdriverConfig, args []string) {
+  if len(args) < 2 {
+    die("invalid shim invocation")
+  }
+  tool := args[0]
+  target := args[1]
+
+  manifest, err := findProjectManifest()
+  if err != nil {
+    die(err.Error())
+  }
+  if manifest != nil {
+    if entry := manifest.Find(tool); entry != nil {
+      repo, err := repository.ReadRepository(config.DataDir)
+      if err != nil {
+        die(err.Error())
+      }
+
+      var version *repository.InstalledVersion = nil
+      toolRef, err := repo.FindInstalledTool(entry.Tool)
+      if err != nil {
+        die(fmt.Sprintf("%s:%d: %s", manifest.Path, entry.Line, err.Error()))
+      }
+      if toolRef != nil {
+        version, err = toolRef.FindMatchingVersion(entry.Version)
+        if err != nil {
+          die(fmt.Sprintf("%s:%d: %s", manifest.Path, entry.Line, err.Error()))
+        }
+      }
+      if version == nil {
+        die(fmt.Sprintf("%s/%s is required by %s, but it's not installed (use `ss install`)",
+          tool, entry.Version, manifest.Path))
+      }
+
+      target = version.GetExecutablePath()
+    }
+  }
+
+  err = syscall.Exec(target, append([]string{tool}, args[2:]...), os.Environ())
+  die(fmt.Sprintf("%s: %s", tool, err.Error()))
+}
+
+/**
+ * Install all the tool versions required by the project manifest
+ */
+func installManifest(config *ScrewdriverConfig, force bool) {
+  manifest, err := findProjectManifest()
+  if err != nil {
+    die(err.Error())
+  }
+  if manifest == nil {
+    die(fmt.Sprintf("there is no `%s` file in this directory, or any of it's parents", ManifestFileName))
+  }
+  if len(manifest.Entries) == 0 {
+    complete(fmt.Sprintf("%s does not require any tools", manifest.Path))
+  }
+
+  // Load registry and repository
+  reg, repo := getRegistryRepository(config)
+  fmt.Printf("%s %s %s\n", Blue("==> "), Gray("Using manifest"), Bold(Gray(manifest.Path)))
+
+  for _, entry := range manifest.Entries {
+    toolInfo, err := reg.FindTool(entry.Tool)
+    if err != nil {
+      die(fmt.Sprintf("%s:%d: %s", manifest.Path, entry.Line, err.Error()))
+    }
+    tool := toolInfo.Name
+
+    // Use an installed version that satisfies the manifest, if there is one
+    var installedVer *repository.InstalledVersion = nil
+    if toolRef, ok := repo.Tools[repository.ToolKey(toolInfo.Registry, tool)]; ok {
+      installedVer, err = toolRef.FindMatchingVersion(entry.Version)
+      if err != nil {
+        die(fmt.Sprintf("%s:%d: %s: %s", manifest.Path, entry.Line, tool, err.Error()))
+      }
+    }
+
+    // Otherwise install it
+    if installedVer == nil {
+      version, err := toolInfo.Versions.Select(entry.Version, config.Channel)
+      if err != nil {
+        die(fmt.Sprintf("%s:%d: %s: %s", manifest.Path, entry.Line, tool, err.Error()))
+      }
+      printVersionWarning(tool, version)
+
+      artifact, errors := repository.FindFirstRunableArtifact(version.Artifacts)
+      if artifact == nil {
+        fmt.Printf("%s %s: no installable artifacts found. I tried:\n", Red("Error:"), tool)
+        printArtifactErrors(errors)
+        os.Exit(1)
+      }
+
+      installDependencies(config, reg, repo, toolInfo, artifact)
+      installedVer, err = repo.InstallToolVersion(toolInfo.Registry, tool, version, artifact)
+      if err != nil {
+        die(fmt.Sprintf("%s: %s", tool, err.Error()))
+      }
+    }
+
+    // Make sure there is a shim for the tool, without changing the version
+    // that is used outside of the project
+    shimTarget := ReadBinShim(config, tool)
+    if shimTarget != "" {
+      if linkedTool, _ := repo.FindToolFromLink(shimTarget); linkedTool == nil {
+        if !force {
+          fmt.Printf("%s %s: there is already a tool with the same name in your path. Not linking.\n",
+            Red("Warning:"), tool)
+          continue
+        }
+        shimTarget = ""
+      }
+    }
+    if shimTarget == "" {
+      shimTarget = installedVer.GetExecutablePath()
+    }
+    err = CreateBinShim(config, shimTarget, tool)
+    if err != nil {
+      die(fmt.Sprintf("%s: %s", tool, err.Error()))
+    }
+  }
+
+  complete(fmt.Sprintf("All the tools required by %s have landed!", manifest.Path))
+}
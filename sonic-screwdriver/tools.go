@@ -35,10 +35,14 @@ func PrintMarkdownText(input []byte) {
 }
 
 /**
- * Get tool version from the tool string
+ * Get tool version from the tool string, that is either `tool:version` or
+ * `tool@constraint` (eg. `tool@^1.4`)
  */
 func SplitVersion(tool string) (string, string) {
-  parts := strings.Split(tool, ":")
+  if idx := strings.Index(tool, "@"); idx >= 0 {
+    return tool[:idx], tool[idx+1:]
+  }
+  parts := strings.SplitN(tool, ":", 2)
   if len(parts) == 1 {
     return tool, ""
   }
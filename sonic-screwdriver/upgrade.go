@@ -4,27 +4,55 @@ import (
   "encoding/json"
   "fmt"
   "time"
+  "io/ioutil"
   "os"
-  "os/exec"
+  "path"
+  "path/filepath"
+  "runtime"
   "strings"
   . "github.com/mesosphere/dcos-sonic-screwdriver/shared"
 )
 
 
 type LatestVersion struct {
-  Version     VersionTriplet
+  Version     SemVer
   URL         string
+
+  // The SHA256 checksum of the binary, as given by the signed manifest
+  Checksum    string
+}
+
+/**
+ * Get the suffixes of the release asset names that can run on this platform,
+ * in order of preference (eg. `sonic-screwdriver.linux-amd64`)
+ */
+func GetPlatformAssetSuffixes() []string {
+  suffixes := []string{
+    fmt.Sprintf(".%s-%s", runtime.GOOS, runtime.GOARCH),
+  }
+
+  // Releases up to 0.1.5 were only shipping a `.darwin` (amd64) binary
+  if runtime.GOOS == "darwin" && runtime.GOARCH == "amd64" {
+    suffixes = append(suffixes, ".darwin")
+  }
+
+  return suffixes
 }
 
 /**
- * Get the latest released version
+ * Get the latest released version. The release information is not signed, so
+ * the version and the checksum of the binary are taken from the release
+ * manifest, that is signed with one of the given keys.
  */
-func GetLatestVersion() (LatestVersion, error) {
+func GetLatestVersion(keys *Keyring) (LatestVersion, error) {
   res := LatestVersion{}
 
   // Download latest version
-  byt, err := Download("http://api.github.com/repos/wavesoft/dcos-sonic-screwdriver/releases/latest", WithDefaults).
+  byt, err := Download("https://api.github.com/repos/wavesoft/dcos-sonic-screwdriver/releases/latest", WithDefaults).
               EventuallyReadAll()
+  if err != nil {
+    return res, fmt.Errorf("error fetching version info: %s", err.Error())
+  }
 
   // Parse contents
   var dat map[string]interface{}
@@ -42,8 +70,8 @@ func GetLatestVersion() (LatestVersion, error) {
     return res, fmt.Errorf("invalid tag name")
   }
 
-  // Scan assets
-  var downloadUrl string = ""
+  // Collect asset URLs, by asset name
+  assetUrls := make(map[string]string)
   var assets []interface{}
   if assets, ok = dat["assets"].([]interface{}); !ok {
     return res, fmt.Errorf("invalid version info: missing `assets`")
@@ -54,29 +82,78 @@ func GetLatestVersion() (LatestVersion, error) {
       return res, fmt.Errorf("invalid version info: invalid field `assets`")
     }
     if url, ok := mapInst["browser_download_url"].(string); ok {
-      if strings.HasSuffix(url, ".darwin") {
-        downloadUrl = url
+      name, ok := mapInst["name"].(string)
+      if !ok {
+        name = path.Base(url)
+      }
+      assetUrls[name] = url
+    }
+  }
+
+  // Pick the first asset that matches our platform
+  var downloadName string = ""
+  for _, suffix := range GetPlatformAssetSuffixes() {
+    for name := range assetUrls {
+      if strings.HasSuffix(name, suffix) {
+        downloadName = name
         break
       }
     }
+    if downloadName != "" {
+      break
+    }
   }
-  if downloadUrl == "" {
-    return res, fmt.Errorf("could not find a download URL")
+  if downloadName == "" {
+    return res, fmt.Errorf("release %s has no binary for %s/%s (expected an asset named `sonic-screwdriver%s`)",
+      tagName, runtime.GOOS, runtime.GOARCH, GetPlatformAssetSuffixes()[0])
   }
 
-  ver, err := VersionFromString(tagName[1:])
+  ver, err := ParseSemVer(tagName[1:])
   if err != nil {
     return res, err
   }
 
-  res.Version = *ver
-  res.URL = downloadUrl
+  // Only trust the version and the binary the signed manifest lists
+  manifestUrl, ok := assetUrls[ReleaseManifestName]
+  sigUrl, sigOk := assetUrls[ReleaseManifestName + ".sig"]
+  if !ok || !sigOk {
+    return res, fmt.Errorf("release %s has no signed release manifest", tagName)
+  }
+  manifestBytes, err := Download(manifestUrl, WithDefaults).
+                        EventuallyReadAll()
+  if err != nil {
+    return res, fmt.Errorf("error fetching the release manifest: %s", err.Error())
+  }
+  sig, err := Download(sigUrl, WithDefaults).
+              EventuallyReadAll()
+  if err != nil {
+    return res, fmt.Errorf("error fetching the release manifest signature: %s", err.Error())
+  }
+  manifest, err := ParseReleaseManifest(manifestBytes, sig, keys)
+  if err != nil {
+    return res, err
+  }
+  if !manifest.Version.Equals(*ver) {
+    return res, fmt.Errorf("release %s is signed as version %s, refusing to upgrade",
+      tagName, manifest.Version.ToString())
+  }
+  checksum, ok := manifest.Assets[downloadName]
+  if !ok {
+    return res, fmt.Errorf("the binary %s is not listed in the manifest of release %s", downloadName, tagName)
+  }
+
+  res.Version = manifest.Version
+  res.URL = assetUrls[downloadName]
+  res.Checksum = checksum
 
   return res, nil
 }
 
 /**
- * Perform upgrade
+ * Perform upgrade, verifying the new binary against the checksum of the
+ * signed release manifest. The checksum covers the release asset as it's
+ * published, which is what `registry-tool sign-release` lists, so it's
+ * validated before the asset is de-compressed.
  */
 func PerformUpgrade(newVersion LatestVersion) error {
 
@@ -86,34 +163,37 @@ func PerformUpgrade(newVersion LatestVersion) error {
     return fmt.Errorf("could not find the location of the tool: %s", err.Error())
   }
 
-  // Rename the current executable
-  bakTarget := replaceTarget + ".bak"
-  err = os.Rename(replaceTarget, bakTarget)
+  // Download the new version next to the current one, so it can replace it
+  // atomically once it's signature is validated
+  tmpFile, err := ioutil.TempFile(filepath.Dir(replaceTarget), ".ss-upgrade-")
   if err != nil {
-    return fmt.Errorf("could not rename old version: %s", err.Error())
+    return fmt.Errorf("could not create the new version: %s", err.Error())
   }
+  tmpFile.Close()
+  newTarget := tmpFile.Name()
 
-  // Download the new version
-  err = Download(newVersion.URL, WithDefaults).
+  // The checksum is validated when the stream is closed, so a mismatching
+  // binary never replaces the current one
+  err = Download(newVersion.URL, WithoutCompression).
          AndShowProgress("").
+         AndValidateChecksum(newVersion.Checksum).
          AndDecompressIfCompressed().
-         EventuallyWriteTo(replaceTarget)
+         EventuallyWriteTo(newTarget)
   if err != nil {
-    os.Remove(replaceTarget)
-    os.Rename(bakTarget, replaceTarget)
-    return fmt.Errorf("could not process file stream: %s", err.Error())
+    os.Remove(newTarget)
+    return fmt.Errorf("upgrade refused, could not process file stream: %s", err.Error())
   }
 
-  // Make it executable and close it
-  os.Chmod(replaceTarget, 0755)
-
-  // Run the new version that is going to remove the backup file
-  cmd := exec.Command(replaceTarget, "complete-upgrade", bakTarget)
-  err = cmd.Start()
+  // Make it executable and put it in place
+  err = os.Chmod(newTarget, 0755)
+  if err != nil {
+    os.Remove(newTarget)
+    return fmt.Errorf("could not make the new version executable: %s", err.Error())
+  }
+  err = os.Rename(newTarget, replaceTarget)
   if err != nil {
-    os.Rename(replaceTarget, replaceTarget + ".check")
-    os.Rename(bakTarget, replaceTarget)
-    return fmt.Errorf("could run the new version: %s", err.Error())
+    os.Remove(newTarget)
+    return fmt.Errorf("could not replace the old version: %s", err.Error())
   }
 
   // Completed
@@ -121,7 +201,8 @@ func PerformUpgrade(newVersion LatestVersion) error {
 }
 
 /**
- * Helper function to complete an upgrade process
+ * Helper function to complete an upgrade process. The previous versions were
+ * calling the new one with the backup of the old one, in order to remove it.
  */
 func CompleteUpgrade(bakTarget string) {
   // Wait for the other process to exit
@@ -3,48 +3,67 @@ package main
 import (
   "os"
   "fmt"
+  "io/ioutil"
+  "github.com/mesosphere/dcos-sonic-screwdriver/repository"
   . "github.com/logrusorgru/aurora"
 )
 
 /**
- * Create a symbolic link on the user bin directory
+ * Create a shim on the user bin directory, that runs the tool version
+ * required by the project manifest, or `fullPath` if there is none
  */
- func CreateBinSymlink(config *ScrewdriverConfig, fullPath string, tool string) error {
+func CreateBinShim(config *ScrewdriverConfig, fullPath string, tool string) error {
   fmt.Printf("%s %s %s\n", Bold(Blue("==> ")), Bold(Gray("Link")), Bold(Blue(tool)))
+
+  // The shims are calling us back to resolve the version
+  ssPath, err := os.Executable()
+  if err != nil {
+    return fmt.Errorf("could not find the location of ss: %s", err.Error())
+  }
+
+  // Replace the shim atomically, since it might be in use
   linkTarget := config.UserBinDir + "/" + tool
-  if _, err := os.Stat(linkTarget); err == nil {
-    os.Remove(linkTarget)
+  err = ioutil.WriteFile(linkTarget + ".tmp", repository.ShimContents(ssPath, tool, fullPath), 0755)
+  if err != nil {
+    return fmt.Errorf("could not create shim: %s", err.Error())
   }
-  return os.Symlink(fullPath, linkTarget)
- }
+  return os.Rename(linkTarget + ".tmp", linkTarget)
+}
 
 /**
- * Remove a symbolic link to the user bin directory
+ * Remove a shim from the user bin directory
  */
-func RemoveBinSymlink(config *ScrewdriverConfig, tool string) error {
+func RemoveBinShim(config *ScrewdriverConfig, tool string) error {
   fmt.Printf("%s %s %s\n", Bold(Blue("==> ")), Bold(Gray("Unlink")), Bold(Blue(tool)))
   linkTarget := config.UserBinDir + "/" + tool
   return os.Remove(linkTarget)
 }
 
 /**
- * Check if a symbolic link already exists in the user bin directory
+ * Check if a shim (or anything else) already exists in the user bin directory
  */
-func HasBinSymlink(config *ScrewdriverConfig, tool string) bool {
+func HasBinShim(config *ScrewdriverConfig, tool string) bool {
   linkTarget := config.UserBinDir + "/" + tool
-  if _, err := os.Stat(linkTarget); err == nil {
+  if _, err := os.Lstat(linkTarget); err == nil {
     return true
   }
   return false
 }
 
 /**
- * Get the target of the bin symlink
+ * Get the default target of the shim (or of the symlink created by the
+ * previous versions). If the file was not created by us, it's own path is
+ * returned, so it's not mistaken for an installed tool.
  */
- func ReadBinSymlink(config *ScrewdriverConfig, tool string) (string, error) {
+func ReadBinShim(config *ScrewdriverConfig, tool string) string {
   linkTarget := config.UserBinDir + "/" + tool
-  if _, err := os.Stat(linkTarget); err != nil {
-    return "", nil
+  if _, err := os.Lstat(linkTarget); err != nil {
+    return ""
+  }
+
+  target, ok := repository.ReadBinTarget(linkTarget)
+  if !ok {
+    return linkTarget
   }
-  return os.Readlink(linkTarget)
+  return target
 }